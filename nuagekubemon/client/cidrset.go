@@ -0,0 +1,141 @@
+/*
+###########################################################################
+#
+#   Filename:           cidrset.go
+#
+#   Author:             Ryan Fredette
+#   Created:            September 21, 2015
+#
+#   Description:        Bitmap-backed CIDR set allocator for fixed-size
+#                        per-node pod subnets
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// ErrNoCIDRsRemaining is returned by CIDRSet.AllocateNext when every
+// sub-CIDR of the configured size has already been allocated.
+var ErrNoCIDRsRemaining = errors.New("no CIDRs remaining in set")
+
+/* CIDRSet divides a single cluster CIDR into equal-sized sub-CIDRs (e.g. a
+ * /16 cluster CIDR split into /24s, one per node) and tracks which of those
+ * sub-CIDRs are in use with a big.Int bitmap, one bit per sub-CIDR.  This is
+ * the allocator shape used by the Kubernetes node-IPAM controller; it's
+ * deterministic and O(1) per bit, unlike the buddy-allocating
+ * IPv4SubnetPool, which is a better fit when the operator wants variable
+ * sized subnets rather than one fixed size per node.
+ */
+type CIDRSet struct {
+	mu             sync.Mutex
+	clusterCIDR    *IPv4Subnet
+	subNetMaskSize int
+	maxCIDRs       int
+	used           big.Int
+	nextCandidate  int
+}
+
+func NewCIDRSet(clusterCIDR *IPv4Subnet, subNetMaskSize int) (*CIDRSet, error) {
+	if subNetMaskSize < clusterCIDR.CIDRMask || subNetMaskSize > 32 {
+		return nil, errors.New(fmt.Sprintf(
+			"Invalid subNetMaskSize %d for cluster CIDR %s", subNetMaskSize,
+			clusterCIDR))
+	}
+	return &CIDRSet{
+		clusterCIDR:    clusterCIDR,
+		subNetMaskSize: subNetMaskSize,
+		maxCIDRs:       1 << uint(subNetMaskSize-clusterCIDR.CIDRMask),
+	}, nil
+}
+
+// subnetAt returns the sub-CIDR at the given index within the set, where
+// index 0 is the first sub-CIDR of the cluster CIDR.
+func (s *CIDRSet) subnetAt(index int) *IPv4Subnet {
+	subnet := &IPv4Subnet{Address: s.clusterCIDR.Address, CIDRMask: s.subNetMaskSize}
+	// The host bits we're free to vary are the ones between the cluster
+	// CIDR's mask and our subNetMaskSize; shift index into that range.
+	shift := uint(32 - s.subNetMaskSize)
+	hostBits := uint(index) << shift
+	for i := 0; i < 4; i++ {
+		byteShift := uint(24 - 8*i)
+		subnet.Address[i] |= uint8((hostBits >> byteShift) & 0xff)
+	}
+	return subnet
+}
+
+// indexOf returns the index of subnet within the set, or an error if subnet
+// isn't a subNetMaskSize-sized sub-CIDR of the cluster CIDR.
+func (s *CIDRSet) indexOf(subnet *IPv4Subnet) (int, error) {
+	if subnet.CIDRMask != s.subNetMaskSize {
+		return 0, errors.New(fmt.Sprintf(
+			"Subnet %s is not a /%d", subnet, s.subNetMaskSize))
+	}
+	if !Contains(s.clusterCIDR, subnet) {
+		return 0, errors.New(fmt.Sprintf(
+			"Subnet %s is not contained in cluster CIDR %s", subnet, s.clusterCIDR))
+	}
+	shift := uint(32 - s.subNetMaskSize)
+	var hostBits uint
+	for i := 0; i < 4; i++ {
+		byteShift := uint(24 - 8*i)
+		hostBits |= uint(subnet.Address[i]) << byteShift
+	}
+	// Drop the cluster CIDR's own network bits, keeping only the index bits.
+	return int((hostBits >> shift) & uint(s.maxCIDRs-1)), nil
+}
+
+// AllocateNext returns the next unallocated sub-CIDR, scanning from
+// nextCandidate and wrapping around.  It returns ErrNoCIDRsRemaining if the
+// set is fully allocated.
+func (s *CIDRSet) AllocateNext() (*IPv4Subnet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < s.maxCIDRs; i++ {
+		candidate := (s.nextCandidate + i) % s.maxCIDRs
+		if s.used.Bit(candidate) == 0 {
+			s.used.SetBit(&s.used, candidate, 1)
+			s.nextCandidate = (candidate + 1) % s.maxCIDRs
+			return s.subnetAt(candidate), nil
+		}
+	}
+	return nil, ErrNoCIDRsRemaining
+}
+
+// Release marks subnet as unallocated, making it available again.
+func (s *CIDRSet) Release(subnet *IPv4Subnet) error {
+	index, err := s.indexOf(subnet)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used.SetBit(&s.used, index, 0)
+	return nil
+}
+
+// Occupy marks every sub-CIDR overlapping subnet as allocated, so that
+// pre-existing node CIDRs (e.g. recovered from the apiserver on restart) can
+// be reserved before AllocateNext starts handing out fresh ones.  subnet may
+// be larger, smaller, or the same size as the set's subNetMaskSize.
+func (s *CIDRSet) Occupy(subnet *IPv4Subnet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < s.maxCIDRs; i++ {
+		if Intersects(s.subnetAt(i), subnet) {
+			s.used.SetBit(&s.used, i, 1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+/*
+###########################################################################
+#
+#   Filename:           controller.go
+#
+#   Author:             Ryan Fredette
+#   Created:            November 23, 2015
+#
+#   Description:        Shared-informer/workqueue pipeline that feeds a
+#                        VsdAPI from Namespace, Pod, Service and
+#                        NetworkPolicy events
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nuagenetworks/openshift-integration/nuagekubemon/api"
+	"github.com/nuagenetworks/openshift-integration/nuagekubemon/config"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "nuagekubemon",
+		Name:      "workqueue_depth",
+		Help:      "Number of keys waiting to be reconciled, by resource.",
+	}, []string{"resource"})
+	reconcileLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nuagekubemon",
+		Name:      "reconcile_latency_seconds",
+		Help:      "Time spent in a single reconcile call against the VSD, by resource.",
+	}, []string{"resource"})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, reconcileLatency)
+}
+
+// Controller drives a VsdAPI from Kubernetes shared informers instead of
+// the ad-hoc nsChannel/serviceChannel polling Run expects: each resource
+// gets its own informer, and every resource but pods its own
+// RateLimitingInterface queue, so a reconcile
+// failure re-queues with exponential backoff rather than taking down the
+// whole process the way Init's glog.Fatal calls used to.
+type Controller struct {
+	vsdAPI VsdAPI
+
+	informerFactory informers.SharedInformerFactory
+	nsInformer      cache.SharedIndexInformer
+	podInformer     cache.SharedIndexInformer
+	serviceInformer cache.SharedIndexInformer
+	policyInformer  cache.SharedIndexInformer
+
+	nsQueue      workqueue.RateLimitingInterface
+	serviceQueue workqueue.RateLimitingInterface
+	policyQueue  workqueue.RateLimitingInterface
+
+	// nsUIDs remembers each namespace's UID, keyed by name, so that a
+	// Deleted reconcile - which only gets the key, since the informer's
+	// indexer has already dropped the object by then - can still tell
+	// HandleNsEvent which namespace generation is being torn down. Only
+	// ever touched from the "namespaces" worker goroutine.
+	nsUIDs map[string]string
+
+	// driftResyncPeriod and resyncOnStart drive reconcileDrift, a periodic
+	// pass that catches namespaces or zones the queues above won't ever see
+	// an event for again: a namespace deleted while nuagekubemon was down,
+	// or a zone left behind because its Delete event was dropped.
+	driftResyncPeriod time.Duration
+	resyncOnStart     bool
+}
+
+// NewController builds a Controller that reconciles vsdAPI from kubeClient's
+// informers, resyncing every nkmConfig.ResyncPeriod.
+func NewController(vsdAPI VsdAPI, kubeClient kubernetes.Interface, nkmConfig *config.NuageKubeMonConfig) *Controller {
+	resync := nkmConfig.ResyncPeriod
+	if resync <= 0 {
+		resync = 30 * time.Minute
+	}
+	driftResync := nkmConfig.DriftResyncPeriod
+	if driftResync <= 0 {
+		driftResync = 10 * time.Minute
+	}
+	c := &Controller{
+		vsdAPI:            vsdAPI,
+		informerFactory:   informers.NewSharedInformerFactory(kubeClient, resync),
+		nsQueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "namespaces"),
+		nsUIDs:            make(map[string]string),
+		serviceQueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "services"),
+		policyQueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "networkpolicies"),
+		driftResyncPeriod: driftResync,
+		resyncOnStart:     nkmConfig.ResyncOnStart,
+	}
+
+	c.nsInformer = c.informerFactory.Core().V1().Namespaces().Informer()
+	c.nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { enqueue(c.nsQueue, obj) },
+		DeleteFunc: func(obj interface{}) { enqueue(c.nsQueue, obj) },
+	})
+
+	// Pods only feed NamedPortCache directly from the event handler; unlike
+	// the other resources there's no VSD call to retry, so pods don't get a
+	// queue of their own.  Pod IP allocation itself happens a level up, when
+	// HandleNsEvent allocates a zone's subnet - this codebase hands out
+	// subnets per namespace, not per pod.
+	c.podInformer = c.informerFactory.Core().V1().Pods().Informer()
+	c.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.updatePod,
+		UpdateFunc: func(oldObj, newObj interface{}) { c.updatePod(newObj) },
+		DeleteFunc: c.removePod,
+	})
+
+	c.serviceInformer = c.informerFactory.Core().V1().Services().Informer()
+	c.serviceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { enqueue(c.serviceQueue, obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) { enqueue(c.serviceQueue, newObj) },
+		DeleteFunc: func(obj interface{}) { enqueue(c.serviceQueue, obj) },
+	})
+
+	c.policyInformer = c.informerFactory.Networking().V1().NetworkPolicies().Informer()
+	c.policyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { enqueue(c.policyQueue, obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) { enqueue(c.policyQueue, newObj) },
+		DeleteFunc: func(obj interface{}) { enqueue(c.policyQueue, obj) },
+	})
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	vsdAPI.SetEventRecorder(broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "nuagekubemon"}))
+
+	return c
+}
+
+func enqueue(queue workqueue.RateLimitingInterface, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("Couldn't get key for object %+v: %s", obj, err)
+		return
+	}
+	queue.Add(key)
+}
+
+func (c *Controller) updatePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	c.vsdAPI.UpdatePodCache(pod.Namespace, pod.Name, pod.Labels, podContainerPorts(pod))
+}
+
+func (c *Controller) removePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			pod, ok = tombstone.Obj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+		} else {
+			return
+		}
+	}
+	c.vsdAPI.RemovePodCache(pod.Namespace, pod.Name)
+}
+
+func podContainerPorts(pod *corev1.Pod) []corev1.ContainerPort {
+	var ports []corev1.ContainerPort
+	for _, container := range pod.Spec.Containers {
+		ports = append(ports, container.Ports...)
+	}
+	return ports
+}
+
+// Run starts every informer, waits for their caches to sync, and then runs
+// one worker goroutine per resource queue until stopCh is closed.
+func (c *Controller) Run(stopCh <-chan struct{}) {
+	c.informerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.nsInformer.HasSynced, c.podInformer.HasSynced,
+		c.serviceInformer.HasSynced, c.policyInformer.HasSynced) {
+		glog.Error("Timed out waiting for informer caches to sync")
+		return
+	}
+
+	if err := c.vsdAPI.ReconcileStore(c.currentNamespaceNames()); err != nil {
+		glog.Errorf("Error reconciling the VSD store against current namespaces: %s", err)
+	}
+
+	go wait.Until(func() { c.runWorker("namespaces", c.nsQueue, c.reconcileNamespace) }, time.Second, stopCh)
+	go wait.Until(func() { c.runWorker("services", c.serviceQueue, c.reconcileService) }, time.Second, stopCh)
+	go wait.Until(func() { c.runWorker("networkpolicies", c.policyQueue, c.reconcilePolicy) }, time.Second, stopCh)
+
+	if c.resyncOnStart {
+		c.reconcileDrift()
+	}
+	go wait.Until(c.reconcileDrift, c.driftResyncPeriod, stopCh)
+
+	<-stopCh
+	c.vsdAPI.Shutdown()
+	c.nsQueue.ShutDown()
+	c.serviceQueue.ShutDown()
+	c.policyQueue.ShutDown()
+}
+
+// runWorker pops keys off queue and hands them to reconcile until queue is
+// shut down, re-queueing with the queue's exponential backoff on error
+// instead of the glog.Fatal Init used to do for every VSD error.
+func (c *Controller) runWorker(resource string, queue workqueue.RateLimitingInterface, reconcile func(key string) error) {
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return
+		}
+		queueDepth.WithLabelValues(resource).Set(float64(queue.Len()))
+		func() {
+			defer queue.Done(key)
+			start := time.Now()
+			err := reconcile(key.(string))
+			reconcileLatency.WithLabelValues(resource).Observe(time.Since(start).Seconds())
+			if err != nil {
+				glog.Errorf("Error reconciling %s %q, re-queueing: %s", resource, key, err)
+				queue.AddRateLimited(key)
+				return
+			}
+			queue.Forget(key)
+		}()
+	}
+}
+
+// reconcileDrift lists the namespaces c.nsInformer's cache currently knows
+// about and hands them to vsdAPI.ReconcileZones, catching the drift the
+// nsQueue's own event-driven reconcileNamespace never gets a chance to
+// see: a namespace deleted while nuagekubemon was down never enqueues a
+// Delete, and its zone would otherwise sit in VSD forever.  The informer's
+// own initial List/Watch sync already replays every existing namespace as
+// an Add, so this isn't needed for a normal startup - it only matters once
+// Kubernetes and VSD have had a chance to drift apart.
+func (c *Controller) reconcileDrift() {
+	names := c.currentNamespaceNames()
+	if err := c.vsdAPI.ReconcileZones(names); err != nil {
+		glog.Errorf("Error reconciling VSD zones against current namespaces: %s", err)
+	}
+	c.vsdAPI.CheckZoneSubnetCapacity()
+}
+
+// currentNamespaceNames lists the namespaces c.nsInformer's cache currently
+// knows about, for reconcileDrift and Run's startup store reconcile.
+func (c *Controller) currentNamespaceNames() []string {
+	var names []string
+	for _, obj := range c.nsInformer.GetIndexer().List() {
+		if ns, ok := obj.(*corev1.Namespace); ok {
+			names = append(names, ns.Name)
+		}
+	}
+	return names
+}
+
+func (c *Controller) reconcileNamespace(key string) error {
+	obj, exists, err := c.nsInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		uid := c.nsUIDs[key]
+		delete(c.nsUIDs, key)
+		return c.vsdAPI.HandleNsEvent(&api.NamespaceEvent{Type: api.Deleted, Name: key, UID: uid})
+	}
+	ns := obj.(*corev1.Namespace)
+	c.nsUIDs[ns.Name] = string(ns.UID)
+	return c.vsdAPI.HandleNsEvent(&api.NamespaceEvent{Type: api.Added, Name: ns.Name, UID: string(ns.UID)})
+}
+
+func (c *Controller) reconcileService(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := c.serviceInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return c.vsdAPI.HandleServiceEvent(&api.ServiceEvent{Type: api.Deleted, Namespace: namespace, Name: name})
+	}
+	svc := obj.(*corev1.Service)
+	return c.vsdAPI.HandleServiceEvent(&api.ServiceEvent{
+		Type:      api.Added,
+		Namespace: svc.Namespace,
+		Name:      svc.Name,
+		ClusterIP: svc.Spec.ClusterIP,
+		Selector:  svc.Spec.Selector,
+	})
+}
+
+func (c *Controller) reconcilePolicy(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := c.policyInformer.GetIndexer().GetByKey(key)
+	if !exists {
+		return c.vsdAPI.DeleteNetworkPolicy(namespace, name)
+	}
+	if err != nil {
+		return err
+	}
+	policy := obj.(*networkingv1.NetworkPolicy)
+	return c.vsdAPI.UpdateNetworkPolicy(policy)
+}
@@ -0,0 +1,58 @@
+/*
+###########################################################################
+#
+#   Filename:           events.go
+#
+#   Author:             Aniket Bhat
+#   Created:            July 25, 2026
+#
+#   Description:        Surfaces VSD failures as Kubernetes Events on the
+#                        Namespace/Service object that triggered them
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// SetEventRecorder gives NuageVsdClient a record.EventRecorder to annotate
+// with when zone/subnet/network-macro creation fails, so `kubectl describe
+// ns foo` (or `describe svc`) surfaces the VSD error next to the object it
+// affects instead of only in glog. Controller builds the recorder, since
+// it's the one holding the kubernetes.Interface a recorder needs to post
+// Events with; a NuageVsdClient used without a Controller (e.g. in a test
+// against MockVsdAPI) simply never gets one, and recordNamespaceFailure/
+// recordServiceFailure become no-ops.
+func (nvsdc *NuageVsdClient) SetEventRecorder(recorder record.EventRecorder) {
+	nvsdc.eventRecorder = recorder
+}
+
+// recordNamespaceFailure posts a Warning Event on the Namespace named name,
+// if an EventRecorder has been set.
+func (nvsdc *NuageVsdClient) recordNamespaceFailure(name, reason, format string, args ...interface{}) {
+	if nvsdc.eventRecorder == nil {
+		return
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	nvsdc.eventRecorder.Eventf(ns, corev1.EventTypeWarning, reason, format, args...)
+}
+
+// recordServiceFailure posts a Warning Event on the Service named
+// namespace/name, if an EventRecorder has been set.
+func (nvsdc *NuageVsdClient) recordServiceFailure(namespace, name, reason, format string, args ...interface{}) {
+	if nvsdc.eventRecorder == nil {
+		return
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	nvsdc.eventRecorder.Eventf(svc, corev1.EventTypeWarning, reason, format, args...)
+}
@@ -21,6 +21,7 @@ package client
 import (
 	"errors"
 	"fmt"
+	"sort"
 )
 
 type IPv4Address [4]uint8
@@ -53,6 +54,22 @@ func (subnet IPv4Subnet) String() string {
 	return fmt.Sprintf("%v/%v", subnet.Address, subnet.CIDRMask)
 }
 
+func (subnet IPv4Subnet) Mask() int {
+	return subnet.CIDRMask
+}
+
+func (subnet IPv4Subnet) addressString() string {
+	return subnet.Address.String()
+}
+
+func (subnet IPv4Subnet) netmaskString() string {
+	return subnet.Netmask().String()
+}
+
+func (subnet IPv4Subnet) vsdIPType() string {
+	return "IPV4"
+}
+
 func (subnet IPv4Subnet) Netmask() IPv4Address {
 	// returns the traditional IPv4 netmask instead of the CIDR
 	// e.g. .../24 would return 255.255.255.0
@@ -106,7 +123,22 @@ func (a *IPv4Subnet) Compare(b *IPv4Subnet) int {
 	}
 	index := a.CIDRMask / 8
 	mask := uint8((256 - uint(1<<uint(8-(a.CIDRMask%8)))) % 256)
-	return int((a.Address[index] & mask) - (b.Address[index] & mask))
+	if a.CIDRMask%8 == 0 {
+		mask = 0xff
+	}
+	// The byte-boundary mask above only covers the byte the mask ends in;
+	// every earlier byte is entirely inside the masked network and has to
+	// be compared in full too, or same-mask subnets that only differ in a
+	// higher-order byte (10.0.0.0/24 vs 10.0.1.0/24) collapse to equal.
+	for i := 0; i < index; i++ {
+		if n := int(a.Address[i]) - int(b.Address[i]); n != 0 {
+			return n
+		}
+	}
+	if index < 4 {
+		return int(a.Address[index]&mask) - int(b.Address[index]&mask)
+	}
+	return 0
 }
 
 func CanMerge(a, b *IPv4Subnet) bool {
@@ -138,19 +170,123 @@ func Merge(a, b *IPv4Subnet) (*IPv4Subnet, error) {
 	return newSubnet, nil
 }
 
-type IPv4SubnetNode struct {
-	subnet *IPv4Subnet
-	next   *IPv4SubnetNode
+// Network returns the subnet's network address (i.e. the first address in
+// its range, with all host bits cleared).
+func (subnet *IPv4Subnet) Network() IPv4Address {
+	lo, _ := ipv4Range(subnet)
+	return uint32ToIPv4(lo)
+}
+
+// Broadcast returns the subnet's broadcast address (i.e. the last address
+// in its range, with all host bits set).
+func (subnet *IPv4Subnet) Broadcast() IPv4Address {
+	_, hi := ipv4Range(subnet)
+	return uint32ToIPv4(hi)
+}
+
+// HostCount returns the number of usable host addresses in the subnet.  For
+// /31 and /32 subnets, every address is considered usable (RFC 3021); for
+// anything larger, the network and broadcast addresses are excluded.
+func (subnet *IPv4Subnet) HostCount() uint64 {
+	total := uint64(1) << uint(32-subnet.CIDRMask)
+	if subnet.CIDRMask >= 31 {
+		return total
+	}
+	return total - 2
 }
 
-type IPv4SubnetPool [33]*IPv4SubnetNode
+// Host returns the nth usable host address in the subnet, where n is
+// 1-indexed (Host(1) is the first usable host, not the network address).
+func (subnet *IPv4Subnet) Host(n int) (IPv4Address, error) {
+	count := subnet.HostCount()
+	if n < 1 || uint64(n) > count {
+		return IPv4Address{}, errors.New(fmt.Sprintf(
+			"Host index %d out of range for %s, which has %d usable hosts",
+			n, subnet, count))
+	}
+	lo, _ := ipv4Range(subnet)
+	offset := uint32(n - 1)
+	if subnet.CIDRMask < 31 {
+		// Host 1 is the address right after the network address.
+		offset = uint32(n)
+	}
+	return uint32ToIPv4(lo + offset), nil
+}
 
-/* A subnet pool is an array of linked lists.  Each list consists only of
- * subnets with the same CIDR netmask (/0 - /32).  When allocating a subnet
- * with netmask X, the pool will first attempt to pick a subnet of the exact
- * size.  If one is not available, it will get a subnet with netmask X-1, then
- * split it to create 2 subnets with netmask X.  It will return 1 of those
- * subnets to the pool, then return the other one.
+// SubnetAt carves subnet into 1<<newPrefixBits equal children and returns
+// the one at index (e.g. 10.3.0.0/16, newPrefixBits 8, index 5 returns
+// 10.3.5.0/24).
+func (subnet *IPv4Subnet) SubnetAt(newPrefixBits, index int) (*IPv4Subnet, error) {
+	newMask := subnet.CIDRMask + newPrefixBits
+	if newPrefixBits < 0 || newMask > 32 {
+		return nil, errors.New(fmt.Sprintf(
+			"Invalid additional prefix bits %d for %s", newPrefixBits, subnet))
+	}
+	childCount := uint32(1) << uint(newPrefixBits)
+	if index < 0 || uint32(index) >= childCount {
+		return nil, errors.New(fmt.Sprintf(
+			"Index %d out of range for %d child subnets", index, childCount))
+	}
+	lo, _ := ipv4Range(subnet)
+	childSize := uint32(1) << uint(32-newMask)
+	return &IPv4Subnet{
+		Address:  uint32ToIPv4(lo + uint32(index)*childSize),
+		CIDRMask: newMask,
+	}, nil
+}
+
+// NextSubnet returns the aligned neighbor immediately after subnet at the
+// same mask.
+func (subnet *IPv4Subnet) NextSubnet() (*IPv4Subnet, error) {
+	if subnet.CIDRMask <= 0 {
+		return nil, errors.New("No subnet after /0")
+	}
+	size := uint64(1) << uint(32-subnet.CIDRMask)
+	lo, _ := ipv4Range(subnet)
+	next := uint64(lo) + size
+	if next+size-1 > 0xffffffff {
+		return nil, errors.New(fmt.Sprintf(
+			"No subnet after %s: would overflow the address space", subnet))
+	}
+	return &IPv4Subnet{Address: uint32ToIPv4(uint32(next)), CIDRMask: subnet.CIDRMask}, nil
+}
+
+// PreviousSubnet returns the aligned neighbor immediately before subnet at
+// the same mask.
+func (subnet *IPv4Subnet) PreviousSubnet() (*IPv4Subnet, error) {
+	if subnet.CIDRMask <= 0 {
+		return nil, errors.New("No subnet before /0")
+	}
+	size := uint64(1) << uint(32-subnet.CIDRMask)
+	lo, _ := ipv4Range(subnet)
+	if uint64(lo) < size {
+		return nil, errors.New(fmt.Sprintf(
+			"No subnet before %s: would underflow the address space", subnet))
+	}
+	return &IPv4Subnet{Address: uint32ToIPv4(uint32(uint64(lo) - size)), CIDRMask: subnet.CIDRMask}, nil
+}
+
+// buddy returns the subnet that `subnet` would merge with to form its
+// immediate parent, i.e. the other half of the split that produced it.
+func (subnet *IPv4Subnet) buddy() *IPv4Subnet {
+	b := *subnet
+	bitPos := subnet.CIDRMask - 1
+	index := bitPos / 8
+	bit := uint8(128) >> uint(bitPos%8)
+	b.Address[index] ^= bit
+	return &b
+}
+
+// IPv4SubnetPool is an array of free lists, one per CIDR netmask (/0 - /32).
+// Each list holds only subnets with that netmask, kept sorted by Compare so
+// that a subnet's buddy (the other half of the split that produced it) can
+// be located with a binary search instead of a linear scan.
+type IPv4SubnetPool [33][]*IPv4Subnet
+
+/* When allocating a subnet with netmask X, the pool will first attempt to
+ * pick a subnet of the exact size.  If one is not available, it will get a
+ * subnet with netmask X-1, then split it to create 2 subnets with netmask X.
+ * It will return 1 of those subnets to the pool, then return the other one.
  */
 func (pool *IPv4SubnetPool) Alloc(size int) (*IPv4Subnet, error) {
 	if size < 0 || size > 32 {
@@ -158,10 +294,9 @@ func (pool *IPv4SubnetPool) Alloc(size int) (*IPv4Subnet, error) {
 	}
 	// If there's already at least 1 subnet of the intended size, remove it
 	// from the list and return it.
-	if pool[size] != nil {
-		node := pool[size]
-		pool[size] = node.next
-		return node.subnet, nil
+	if list := pool[size]; len(list) > 0 {
+		pool[size] = list[1:]
+		return list[0], nil
 	}
 	// If not, get a larger subnet (1 CIDR mask less), and split it to create 2
 	// subnets of the expected size.
@@ -183,46 +318,189 @@ func (pool *IPv4SubnetPool) Alloc(size int) (*IPv4Subnet, error) {
 	return loSubnet, nil
 }
 
-/* When freeing a subnet, first the pool should be checked for another subnet
- * with the same netmask that it can be merged with (e.g. 10.0.0.0/25 and
- * 10.0.0.128/25 can be merged into 10.0.0.0/24).  If a merge can be done, both
- * subnets should temporarily be allocated, the subnets merged, then the merged
- * subnet should be freed.
- *
- * I've had some issues with figuring out a fast way to check if they can be
- * merged, so for the current version, no merge checks are made.  In the
- * current implementation, we will always request a /24 subnet, so eventually
- * the entire pool will gravitate toward fragmenting at the /24 level.  Because
- * that's the size we care about, it shouldn't be an issue until the
- * implementation requires bigger subnets to be available.
+// search returns the position in pool[mask] at which subnet either already
+// exists, or should be inserted to keep the list sorted by Compare.
+func (pool *IPv4SubnetPool) search(mask int, subnet *IPv4Subnet) int {
+	list := pool[mask]
+	return sort.Search(len(list), func(i int) bool {
+		return subnet.Compare(list[i]) <= 0
+	})
+}
+
+func (pool *IPv4SubnetPool) insert(mask int, subnet *IPv4Subnet) {
+	list := pool[mask]
+	i := pool.search(mask, subnet)
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = subnet
+	pool[mask] = list
+}
+
+func (pool *IPv4SubnetPool) remove(mask, i int) {
+	list := pool[mask]
+	pool[mask] = append(list[:i], list[i+1:]...)
+}
+
+/* When freeing a subnet, the pool checks whether the subnet's buddy (e.g.
+ * 10.0.0.0/25's buddy is 10.0.0.128/25) is already free at the same
+ * netmask.  If so, both are removed, merged into their shared parent, and
+ * the parent is freed in turn, recursively coalescing as far as possible.
+ * This keeps the pool from fragmenting down to the smallest size ever
+ * requested, letting long-running clusters recover large blocks after node
+ * churn.
  */
 func (pool *IPv4SubnetPool) Free(subnet *IPv4Subnet) error {
 	if subnet.CIDRMask < 0 || subnet.CIDRMask > 32 {
 		return errors.New(fmt.Sprintf("Cannot free bad subnet %s", subnet))
 	}
-	var prev, curr *IPv4SubnetNode
-	curr = pool[subnet.CIDRMask]
-	// If there's nothing in the list, or the current subnet would sort before
-	// the one at the beginning of this list, insert it first.
-	if curr == nil || subnet.Compare(curr.subnet) < 0 {
-		pool[subnet.CIDRMask] = &IPv4SubnetNode{subnet, curr}
+	i := pool.search(subnet.CIDRMask, subnet)
+	if list := pool[subnet.CIDRMask]; i < len(list) && subnet.Compare(list[i]) == 0 {
+		return errors.New(fmt.Sprintf("Double free of %s", subnet))
+	}
+	if subnet.CIDRMask > 0 {
+		buddy := subnet.buddy()
+		j := pool.search(subnet.CIDRMask, buddy)
+		if list := pool[subnet.CIDRMask]; j < len(list) && buddy.Compare(list[j]) == 0 {
+			pool.remove(subnet.CIDRMask, j)
+			parent, err := Merge(subnet, buddy)
+			if err != nil {
+				return err
+			}
+			return pool.Free(parent)
+		}
+	}
+	pool.insert(subnet.CIDRMask, subnet)
+	return nil
+}
+
+func ipv4ToUint32(addr IPv4Address) uint32 {
+	return uint32(addr[0])<<24 | uint32(addr[1])<<16 | uint32(addr[2])<<8 | uint32(addr[3])
+}
+
+func uint32ToIPv4(n uint32) IPv4Address {
+	return IPv4Address{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}
+}
+
+// ipv4Range returns the first and last address covered by subnet.
+func ipv4Range(subnet *IPv4Subnet) (lo, hi uint32) {
+	lo = ipv4ToUint32(subnet.Address)
+	if subnet.CIDRMask >= 32 {
+		return lo, lo
+	}
+	return lo, lo | (uint32(1)<<uint(32-subnet.CIDRMask) - 1)
+}
+
+// Contains reports whether every address in inner also falls within outer.
+func Contains(outer, inner *IPv4Subnet) bool {
+	if outer.CIDRMask > inner.CIDRMask {
+		return false
+	}
+	oLo, oHi := ipv4Range(outer)
+	iLo, iHi := ipv4Range(inner)
+	return oLo <= iLo && iHi <= oHi
+}
+
+// Intersects reports whether a and b share any addresses at all, regardless
+// of whether either one contains the other.
+func Intersects(a, b *IPv4Subnet) bool {
+	aLo, aHi := ipv4Range(a)
+	bLo, bHi := ipv4Range(b)
+	return aLo <= bHi && bLo <= aHi
+}
+
+// Equal reports whether a and b describe the same network.
+func Equal(a, b *IPv4Subnet) bool {
+	return a.CIDRMask == b.CIDRMask && a.Address == b.Address
+}
+
+// maxExpandMask is the smallest (i.e. most permissive) CIDR mask Expand will
+// enumerate; anything larger than a /16 is refused rather than building a
+// multi-million-element slice.
+const maxExpandMask = 16
+
+// Expand enumerates every host address covered by subnet.  It returns an
+// error instead of allocating an unreasonably large slice if subnet is
+// bigger than a /16.
+func Expand(subnet *IPv4Subnet) ([]IPv4Address, error) {
+	if subnet.CIDRMask < maxExpandMask {
+		return nil, errors.New(fmt.Sprintf(
+			"Refusing to expand %s: more than %d hosts", subnet,
+			uint32(1)<<uint(32-maxExpandMask)))
+	}
+	lo, hi := ipv4Range(subnet)
+	addrs := make([]IPv4Address, 0, hi-lo+1)
+	for n := lo; n <= hi; n++ {
+		addrs = append(addrs, uint32ToIPv4(n))
+	}
+	return addrs, nil
+}
+
+// MergeAll returns the smallest set of CIDRs that together cover exactly the
+// same addresses as subnets, by sorting the input, dropping any subnet
+// that's wholly contained in another, and repeatedly applying Merge to
+// adjacent buddies until no more merges are possible.
+func MergeAll(subnets []*IPv4Subnet) []*IPv4Subnet {
+	if len(subnets) == 0 {
 		return nil
 	}
-	prev = curr
-	curr = curr.next
-	for curr != nil {
-		switch {
-		case subnet.Compare(curr.subnet) == 0:
-			return errors.New(fmt.Sprintf("Double free of %s", subnet))
-		case subnet.Compare(curr.subnet) < 0:
-			prev.next = &IPv4SubnetNode{subnet, curr}
-			return nil
+	work := make([]*IPv4Subnet, len(subnets))
+	copy(work, subnets)
+	sortByRange := func() {
+		sort.Slice(work, func(i, j int) bool {
+			iLo, _ := ipv4Range(work[i])
+			jLo, _ := ipv4Range(work[j])
+			if iLo != jLo {
+				return iLo < jLo
+			}
+			// Larger subnets (smaller masks) first, so containment checks
+			// below see the covering subnet before the ones it covers.
+			return work[i].CIDRMask < work[j].CIDRMask
+		})
+	}
+	sortByRange()
+	deduped := work[:0]
+	for _, s := range work {
+		if len(deduped) > 0 && Contains(deduped[len(deduped)-1], s) {
+			continue
+		}
+		deduped = append(deduped, s)
+	}
+	for {
+		merged := false
+		result := make([]*IPv4Subnet, 0, len(deduped))
+		for i := 0; i < len(deduped); i++ {
+			if i+1 < len(deduped) && CanMerge(deduped[i], deduped[i+1]) {
+				if parent, err := Merge(deduped[i], deduped[i+1]); err == nil {
+					result = append(result, parent)
+					i++
+					merged = true
+					continue
+				}
+			}
+			result = append(result, deduped[i])
+		}
+		deduped = result
+		if !merged {
+			break
+		}
+	}
+	return deduped
+}
+
+// Compact walks the pool from the smallest subnets to the largest,
+// re-freeing every subnet at each level.  Free() already merges a subnet
+// with its buddy when one is present, so this reclaims any fragmentation
+// left behind by a burst of Free calls whose buddies didn't happen to be
+// freed back-to-back.
+func (pool *IPv4SubnetPool) Compact() error {
+	for mask := 32; mask >= 1; mask-- {
+		list := pool[mask]
+		pool[mask] = nil
+		for _, subnet := range list {
+			if err := pool.Free(subnet); err != nil {
+				return err
+			}
 		}
-		prev = curr
-		curr = curr.next
 	}
-	// We reached the end of the list (prev.next is nil), so add the subnet to
-	// the end of it.
-	prev.next = &IPv4SubnetNode{subnet, nil}
 	return nil
 }
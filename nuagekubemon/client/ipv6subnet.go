@@ -0,0 +1,238 @@
+/*
+###########################################################################
+#
+#   Filename:           ipv6subnet.go
+#
+#   Author:             Ryan Fredette
+#   Created:            September 14, 2015
+#
+#   Description:        IPv6 Address, Subnet, and Subnet Pool management
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+type IPv6Address [16]uint8
+
+func (addr IPv6Address) String() string {
+	return net.IP(addr[:]).String()
+}
+
+type IPv6Subnet struct {
+	Address  IPv6Address
+	CIDRMask int //e.g. 64, not the expanded netmask
+}
+
+func IPv6SubnetFromString(input string) (*IPv6Subnet, error) {
+	ip, ipnet, err := net.ParseCIDR(input)
+	if err != nil {
+		return nil, err
+	}
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return nil, errors.New(fmt.Sprintf(
+			"Invalid IPv6 address in input string %q", input))
+	}
+	maskSize, totalSize := ipnet.Mask.Size()
+	if totalSize != 128 {
+		return nil, errors.New(fmt.Sprintf(
+			"Invalid IPv6 mask in input string %q", input))
+	}
+	output := &IPv6Subnet{CIDRMask: maskSize}
+	copy(output.Address[:], ip16)
+	return output, nil
+}
+
+func (subnet IPv6Subnet) String() string {
+	return fmt.Sprintf("%v/%v", subnet.Address, subnet.CIDRMask)
+}
+
+func (subnet IPv6Subnet) Mask() int {
+	return subnet.CIDRMask
+}
+
+func (subnet IPv6Subnet) addressString() string {
+	return subnet.Address.String()
+}
+
+func (subnet IPv6Subnet) netmaskString() string {
+	return subnet.Netmask().String()
+}
+
+func (subnet IPv6Subnet) vsdIPType() string {
+	return "IPV6"
+}
+
+func (subnet IPv6Subnet) Netmask() IPv6Address {
+	var netmask IPv6Address
+	for i, bits := 0, subnet.CIDRMask; i < 16 && bits > 0; i, bits = i+1, bits-8 {
+		switch {
+		case bits >= 8:
+			netmask[i] = 0xff
+		default:
+			netmask[i] = uint8(0xff << uint(8-bits))
+		}
+	}
+	return netmask
+}
+
+func (subnet *IPv6Subnet) Split() (*IPv6Subnet, *IPv6Subnet, error) {
+	if subnet.CIDRMask >= 128 {
+		return nil, nil, errors.New("Cannot split /128 address space")
+	}
+	loSubnet, hiSubnet := &IPv6Subnet{}, &IPv6Subnet{}
+	loSubnet.Address = subnet.Address
+	hiSubnet.Address = subnet.Address
+	loSubnet.CIDRMask = subnet.CIDRMask + 1
+	hiSubnet.CIDRMask = subnet.CIDRMask + 1
+	index := subnet.CIDRMask / 8
+	offset := uint(subnet.CIDRMask % 8)
+	bit := uint8(128) >> offset
+	loSubnet.Address[index] &= ^bit
+	hiSubnet.Address[index] |= bit
+	return loSubnet, hiSubnet, nil
+}
+
+// Compare `a` to `b`.  If `a > b`, the result will be positive.  If `a < b`,
+// the result will be negative.  If `a == b`, the result will be 0.
+func (a *IPv6Subnet) Compare(b *IPv6Subnet) int {
+	// For sorting purposes, a subnet with a smaller mask (larger size) will
+	// always be greater than a subnet with a larger mask.
+	if n := b.CIDRMask - a.CIDRMask; n != 0 {
+		return n
+	}
+	index := a.CIDRMask / 8
+	mask := uint8((256 - uint(1<<uint(8-(a.CIDRMask%8)))) % 256)
+	if a.CIDRMask%8 == 0 {
+		mask = 0xff
+	}
+	for i := 0; i < index; i++ {
+		if n := int(a.Address[i]) - int(b.Address[i]); n != 0 {
+			return n
+		}
+	}
+	if index < 16 {
+		return int(a.Address[index]&mask) - int(b.Address[index]&mask)
+	}
+	return 0
+}
+
+func CanMergeV6(a, b *IPv6Subnet) bool {
+	// We can't merge the /0 address space.
+	if a.CIDRMask <= 0 || b.CIDRMask <= 0 {
+		return false
+	}
+	// An address can't be merged with itself.
+	if a.Compare(b) == 0 {
+		return false
+	}
+	// Addresses with different netmasks can't be merged.
+	if a.CIDRMask != b.CIDRMask {
+		return false
+	}
+	aCopy := &IPv6Subnet{a.Address, a.CIDRMask - 1}
+	bCopy := &IPv6Subnet{b.Address, b.CIDRMask - 1}
+	return aCopy.Compare(bCopy) == 0
+}
+
+func MergeV6(a, b *IPv6Subnet) (*IPv6Subnet, error) {
+	if !CanMergeV6(a, b) {
+		return nil, errors.New(fmt.Sprintf("Can't merge subnets %s and %s!", a, b))
+	}
+	newSubnet := &IPv6Subnet{a.Address, a.CIDRMask - 1}
+	index := newSubnet.CIDRMask / 8
+	offset := uint(newSubnet.CIDRMask % 8)
+	if offset != 0 {
+		mask := uint8(uint(1<<8 - 1<<uint(8-offset)))
+		newSubnet.Address[index] &= mask
+	}
+	for i := index + 1; i < 16; i++ {
+		newSubnet.Address[i] = 0
+	}
+	return newSubnet, nil
+}
+
+/* An IPv6SubnetPool is the /128-scale equivalent of IPv4SubnetPool.  A dense
+ * array indexed by CIDRMask (0-128) would waste very little memory, but the
+ * free lists at each prefix length can hold arbitrarily many subnets once a
+ * large v6 allocation (e.g. a /32 or /48 cluster range) is carved up, so each
+ * list is kept as a slice sorted by Compare and is only allocated for prefix
+ * lengths that are actually in use.
+ */
+type IPv6SubnetPool struct {
+	free map[int][]*IPv6Subnet
+}
+
+func NewIPv6SubnetPool() *IPv6SubnetPool {
+	return &IPv6SubnetPool{free: make(map[int][]*IPv6Subnet)}
+}
+
+func (pool *IPv6SubnetPool) Alloc(size int) (*IPv6Subnet, error) {
+	if size < 0 || size > 128 {
+		return nil, errors.New("Invalid subnet size.  Expected between /0 and /128")
+	}
+	if pool.free == nil {
+		pool.free = make(map[int][]*IPv6Subnet)
+	}
+	// If there's already at least 1 subnet of the intended size, remove it
+	// from the list and return it.
+	if list := pool.free[size]; len(list) > 0 {
+		subnet := list[0]
+		pool.free[size] = list[1:]
+		return subnet, nil
+	}
+	// If not, get a larger subnet (1 CIDR mask less), and split it to create 2
+	// subnets of the expected size.
+	bigSubnet, err := pool.Alloc(size - 1)
+	if err != nil {
+		return nil, err
+	}
+	loSubnet, hiSubnet, err := bigSubnet.Split()
+	if err != nil {
+		pool.Free(bigSubnet)
+		return nil, err
+	}
+	// Of the two subnets from the split, only one is needed, so release the other.
+	err = pool.Free(hiSubnet)
+	if err != nil {
+		pool.Free(bigSubnet)
+		return nil, err
+	}
+	return loSubnet, nil
+}
+
+// Free inserts subnet into the sorted free list for its prefix length.
+// Unlike IPv4SubnetPool.Free, no merge with a buddy is attempted.
+func (pool *IPv6SubnetPool) Free(subnet *IPv6Subnet) error {
+	if subnet.CIDRMask < 0 || subnet.CIDRMask > 128 {
+		return errors.New(fmt.Sprintf("Cannot free bad subnet %s", subnet))
+	}
+	if pool.free == nil {
+		pool.free = make(map[int][]*IPv6Subnet)
+	}
+	list := pool.free[subnet.CIDRMask]
+	i := sort.Search(len(list), func(i int) bool {
+		return subnet.Compare(list[i]) <= 0
+	})
+	if i < len(list) && subnet.Compare(list[i]) == 0 {
+		return errors.New(fmt.Sprintf("Double free of %s", subnet))
+	}
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = subnet
+	pool.free[subnet.CIDRMask] = list
+	return nil
+}
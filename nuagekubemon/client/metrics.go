@@ -0,0 +1,108 @@
+/*
+###########################################################################
+#
+#   Filename:           metrics.go
+#
+#   Author:             Aniket Bhat
+#   Created:            July 25, 2026
+#
+#   Description:        Prometheus instrumentation for VSD REST calls, and
+#                        the /metrics handler that exposes it
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/jmcvetta/napping"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// vsdRequestDuration and vsdRequestsInFlight are labeled by operation
+	// (e.g. "create_zone", "delete_subnet") and resource (e.g. "zone",
+	// "subnet", "acl_entry"), so a dashboard can slice either by what call
+	// was made or what kind of VSD object it touched.
+	vsdRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nuagekubemon",
+		Name:      "vsd_request_duration_seconds",
+		Help:      "Latency of a VSD REST call, by operation, resource and response status.",
+	}, []string{"operation", "resource", "status"})
+	vsdRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "nuagekubemon",
+		Name:      "vsd_requests_in_flight",
+		Help:      "Number of VSD REST calls currently outstanding, by operation and resource.",
+	}, []string{"operation", "resource"})
+	vsdConflictRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nuagekubemon",
+		Name:      "vsd_conflict_retries_total",
+		Help:      "Number of times a VSD REST call returned 409 Conflict, by operation.",
+	}, []string{"operation"})
+	vsdPoolExhaustion = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nuagekubemon",
+		Name:      "vsd_pool_exhaustion_total",
+		Help:      "Number of times a subnet pool had no block left to allocate, by pool.",
+	}, []string{"pool"})
+	vsdAclPriorityOverflow = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "nuagekubemon",
+		Name:      "vsd_acl_priority_overflow_total",
+		Help:      "Number of times NextAvailablePriority ran past the ACL priority range VSD allows.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(vsdRequestDuration, vsdRequestsInFlight, vsdConflictRetries, vsdPoolExhaustion, vsdAclPriorityOverflow)
+}
+
+// instrumentVsdRequest runs fn - a single Post/Get/Put/Delete against the
+// VSD - under Prometheus instrumentation: an in-flight gauge for the
+// duration of the call, a latency histogram on completion, and a 409
+// counter, all labeled by operation (e.g. "create_zone") and resource
+// (e.g. "zone"). fn's own retry wrapper (vsdRequestPool.do), if it has one,
+// runs inside this, so the histogram reflects what a caller actually waited
+// for - not each individual attempt. GetZoneID's coalescing wraps this call
+// from outside, so a caller folded into another's in-flight lookup is not
+// recorded again.
+func instrumentVsdRequest(operation, resource string, fn func() (*napping.Response, error)) (*napping.Response, error) {
+	vsdRequestsInFlight.WithLabelValues(operation, resource).Inc()
+	start := time.Now()
+	resp, err := fn()
+	vsdRequestsInFlight.WithLabelValues(operation, resource).Dec()
+
+	status := "error"
+	if err == nil && resp != nil {
+		status = strconv.Itoa(resp.Status())
+		if resp.Status() == http.StatusConflict {
+			vsdConflictRetries.WithLabelValues(operation).Inc()
+		}
+	}
+	vsdRequestDuration.WithLabelValues(operation, resource, status).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// ServeMetrics starts an HTTP server exposing the metrics above at /metrics
+// on addr, and runs until the process exits - the same lifetime as the
+// VSD client itself. Errors (typically the port already being in use) are
+// logged rather than returned, since a stuck metrics endpoint shouldn't
+// stop nuagekubemon from reconciling the cluster.
+func (nvsdc *NuageVsdClient) ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			glog.Errorf("Metrics server on %s exited: %s", addr, err)
+		}
+	}()
+}
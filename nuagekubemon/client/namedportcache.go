@@ -0,0 +1,88 @@
+/*
+###########################################################################
+#
+#   Filename:           namedportcache.go
+#
+#   Author:             Ryan Fredette
+#   Created:            October 26, 2015
+#
+#   Description:        Per-pod named container port index used to resolve
+#                        NetworkPolicy named ports
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NamedPortCache indexes each pod's labels and named container ports,
+// keyed by namespace/podName, so NuageVsdClient.ResolveNamedPort can turn a
+// NetworkPolicy's named port into the numeric ports its selected pods
+// actually expose.  It's populated from a pod informer.
+type NamedPortCache struct {
+	mu   sync.Mutex
+	pods map[string]namedPortCacheEntry
+}
+
+type namedPortCacheEntry struct {
+	labels map[string]string
+	ports  map[string]corev1.ContainerPort //port name -> container port
+}
+
+func NewNamedPortCache() *NamedPortCache {
+	return &NamedPortCache{pods: make(map[string]namedPortCacheEntry)}
+}
+
+func namedPortCacheKey(namespace, podName string) string {
+	return namespace + "/" + podName
+}
+
+// Update replaces the labels and named ports tracked for namespace/podName.
+// Call it whenever a pod informer reports the pod as added or updated.
+func (c *NamedPortCache) Update(namespace, podName string, labels map[string]string, containerPorts []corev1.ContainerPort) {
+	ports := make(map[string]corev1.ContainerPort)
+	for _, cp := range containerPorts {
+		if cp.Name != "" {
+			ports[cp.Name] = cp
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pods[namedPortCacheKey(namespace, podName)] = namedPortCacheEntry{labels: labels, ports: ports}
+}
+
+// Remove forgets namespace/podName.  Call it when a pod informer reports
+// the pod as deleted.
+func (c *NamedPortCache) Remove(namespace, podName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pods, namedPortCacheKey(namespace, podName))
+}
+
+// PodLabels returns the labels of every pod currently cached for namespace,
+// keyed by pod name.  It's used to check whether a Service's selector and a
+// NetworkPolicy's PodSelector both match at least one real pod, without
+// either selector having to be resolved to pods itself.
+func (c *NamedPortCache) PodLabels(namespace string) map[string]map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := namespace + "/"
+	labels := make(map[string]map[string]string)
+	for key, entry := range c.pods {
+		if podName := strings.TrimPrefix(key, prefix); podName != key {
+			labels[podName] = entry.labels
+		}
+	}
+	return labels
+}
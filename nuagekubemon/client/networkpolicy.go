@@ -0,0 +1,562 @@
+/*
+###########################################################################
+#
+#   Filename:           networkpolicy.go
+#
+#   Author:             Ryan Fredette
+#   Created:            October 19, 2015
+#
+#   Description:        Translation of Kubernetes NetworkPolicy objects
+#                        into VSD policy groups and ACL entries
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/jmcvetta/napping"
+	"github.com/nuagenetworks/openshift-integration/nuagekubemon/api"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// networkPolicyPriorityFloor puts every ACL entry a NetworkPolicy generates
+// after the intra-zone allow entry (priority 0) and the zone-to-services
+// entries CreateSpecificZoneAcls installs (priority 300 and up), but well
+// before the intra-domain drop entry CreateIngressAclEntries/
+// CreateEgressAclEntries install at the maximum VSD priority.
+const networkPolicyPriorityFloor = 100000
+
+// networkPolicyState is the bookkeeping CreateNetworkPolicy needs to find
+// everything DeleteNetworkPolicy has to clean up again; it isn't part of
+// NamespaceData because a policy's lifetime is independent of its
+// namespace's.
+type networkPolicyState struct {
+	policyGroupID string
+
+	// ingressAcls and egressAcls map a ruleAclKey - the (rule index, peer
+	// location, protocol, port) tuple that identifies one generated ACL
+	// entry - to the ID CreateAclEntry returned for it.  Keying by content
+	// instead of keeping a plain slice is what lets reconcileRuleAclEntries
+	// tell an unchanged rule from a changed one on Update and leave the
+	// former alone.
+	ingressAcls map[string]string
+	egressAcls  map[string]string
+
+	// podSelector is kept around so a Service add/delete arriving after
+	// CreateNetworkPolicy can call reconcileServiceAcls again without
+	// needing the original NetworkPolicy object.
+	podSelector *metav1.LabelSelector
+
+	// serviceMacroGroupID, serviceMacroIDs and serviceAclIDs are
+	// reconcileServiceAcls's bookkeeping: the VSD network macro group
+	// standing in for "ClusterIPs of Services backed by this policy's
+	// pods", the macro created for each such Service (keyed by
+	// namespace/name), and the ACL entries that FORWARD traffic from that
+	// group to the policy group.
+	serviceMacroGroupID string
+	serviceMacroIDs     map[string]string
+	serviceAclIDs       []string
+}
+
+func networkPolicyKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func policyGroupName(namespace, name string) string {
+	return "NetworkPolicy-" + namespace + "-" + name
+}
+
+func (nvsdc *NuageVsdClient) CreatePolicyGroup(domainID, name string) (string, error) {
+	result := make([]api.VsdObject, 1)
+	payload := api.VsdObject{
+		Name:        name,
+		Description: "Auto-generated policy group for Kubernetes NetworkPolicy",
+	}
+	e := api.RESTError{}
+	resp, err := instrumentVsdRequest("create_policy_group", "policy_group", func() (*napping.Response, error) {
+		return nvsdc.session.Post(nvsdc.url+"domains/"+domainID+"/policygroups", &payload, &result, &e)
+	})
+	if err != nil {
+		glog.Error("Error when creating policy group", err)
+		return "", err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when creating policy group")
+	switch resp.Status() {
+	case 201:
+		glog.Infoln("Created the policy group:", result[0].ID)
+		return result[0].ID, nil
+	case 409:
+		//Policy group already exists, call Get to retrieve the ID
+		id, err := nvsdc.GetPolicyGroupID(domainID, name)
+		if err != nil {
+			glog.Errorf("Error when getting policy group ID: %s", err)
+			return "", err
+		}
+		return id, nil
+	default:
+		return "", VsdErrorResponse(resp, &e)
+	}
+}
+
+func (nvsdc *NuageVsdClient) GetPolicyGroupID(domainID, name string) (string, error) {
+	result := make([]api.VsdObject, 1)
+	h := nvsdc.session.Header
+	h.Add("X-Nuage-Filter", `name == "`+name+`"`)
+	e := api.RESTError{}
+	resp, err := instrumentVsdRequest("get_policy_group_id", "policy_group", func() (*napping.Response, error) {
+		return nvsdc.session.Get(nvsdc.url+"domains/"+domainID+"/policygroups", nil, &result, &e)
+	})
+	h.Del("X-Nuage-Filter")
+	if err != nil {
+		glog.Errorf("Error when getting policy group ID %s", err)
+		return "", err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when getting policy group ID")
+	if resp.Status() == 200 {
+		if result[0].Name == name {
+			return result[0].ID, nil
+		} else if result[0].Name == "" {
+			return "", errors.New("Policy group not found")
+		} else {
+			return "", errors.New(fmt.Sprintf(
+				"Found %q instead of %q", result[0].Name, name))
+		}
+	} else {
+		return "", VsdErrorResponse(resp, &e)
+	}
+}
+
+func (nvsdc *NuageVsdClient) DeletePolicyGroup(id string) error {
+	result := make([]struct{}, 1)
+	e := api.RESTError{}
+	url := nvsdc.url + "policygroups/" + id + "?responseChoice=1"
+	resp, err := instrumentVsdRequest("delete_policy_group", "policy_group", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(url, &result, &e)
+	})
+	if err != nil {
+		glog.Errorf("Error when deleting policy group with ID %s: %s", id, err)
+		return err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when deleting policy group")
+	switch resp.Status() {
+	case 204:
+		return nil
+	default:
+		return VsdErrorResponse(resp, &e)
+	}
+}
+
+// protocolToNumeric converts the Protocol named in a NetworkPolicyPort into
+// the numeric IP protocol VSD ACL entries expect; Kubernetes defaults an
+// unset Protocol to TCP, so we do too.
+func protocolToNumeric(proto *corev1.Protocol) string {
+	if proto == nil {
+		return "6"
+	}
+	switch *proto {
+	case corev1.ProtocolUDP:
+		return "17"
+	case corev1.ProtocolSCTP:
+		return "132"
+	default:
+		return "6"
+	}
+}
+
+// aclRule is one (protocol, port) pair an ACL entry should be created for.
+type aclRule struct {
+	protocol string
+	port     string
+}
+
+// ResolveNamedPort returns the distinct numeric ports named name resolves to
+// across every pod in namespace matched by selector and using proto,
+// deduplicated.  It returns no ports (rather than an error) if nothing
+// matches, since a named port that doesn't resolve yet is routine - pods
+// matching the policy's selector may not have been created yet - and
+// callers should log a warning and move on rather than fail the rule.
+func (nvsdc *NuageVsdClient) ResolveNamedPort(namespace string, selector *metav1.LabelSelector, name string, proto corev1.Protocol) []uint16 {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		glog.Errorf("Invalid label selector resolving named port %q in namespace %s: %s", name, namespace, err)
+		return nil
+	}
+	nvsdc.namedPorts.mu.Lock()
+	defer nvsdc.namedPorts.mu.Unlock()
+	seen := make(map[uint16]bool)
+	var resolved []uint16
+	prefix := namespace + "/"
+	for key, entry := range nvsdc.namedPorts.pods {
+		if !strings.HasPrefix(key, prefix) || !sel.Matches(labels.Set(entry.labels)) {
+			continue
+		}
+		cp, exists := entry.ports[name]
+		if !exists || (cp.Protocol != "" && cp.Protocol != proto) {
+			continue
+		}
+		port := uint16(cp.ContainerPort)
+		if !seen[port] {
+			seen[port] = true
+			resolved = append(resolved, port)
+		}
+	}
+	return resolved
+}
+
+// expandPorts turns a NetworkPolicyPort list into the aclRules to create one
+// ACL entry per.  A numeric port becomes a single aclRule; a named port is
+// resolved via ResolveNamedPort against the policy's own PodSelector (VSD
+// ACL entries describe traffic to/from those pods, so that's whose ports
+// the name refers to) and becomes one aclRule per distinct numeric port it
+// resolves to, or none - with a warning, not an error - if it resolves to
+// none yet.
+func (nvsdc *NuageVsdClient) expandPorts(namespace string, podSelector *metav1.LabelSelector, ports []networkingv1.NetworkPolicyPort) []aclRule {
+	if len(ports) == 0 {
+		return []aclRule{{protocol: "ANY"}}
+	}
+	var rules []aclRule
+	for _, port := range ports {
+		proto := corev1.ProtocolTCP
+		if port.Protocol != nil {
+			proto = *port.Protocol
+		}
+		protocol := protocolToNumeric(port.Protocol)
+		if port.Port == nil {
+			rules = append(rules, aclRule{protocol: protocol})
+			continue
+		}
+		if port.Port.Type == intstr.Int {
+			rules = append(rules, aclRule{protocol: protocol, port: fmt.Sprintf("%d", port.Port.IntValue())})
+			continue
+		}
+		resolved := nvsdc.ResolveNamedPort(namespace, podSelector, port.Port.StrVal, proto)
+		if len(resolved) == 0 {
+			glog.Warningf("Named port %q in namespace %s didn't resolve to any pod; skipping this port for now", port.Port.StrVal, namespace)
+			continue
+		}
+		for _, numericPort := range resolved {
+			rules = append(rules, aclRule{protocol: protocol, port: fmt.Sprintf("%d", numericPort)})
+		}
+	}
+	return rules
+}
+
+// aclLocation is the (LocationType, LocationID) or (NetworkType, NetworkID)
+// pair an ACL entry uses to describe one side of a rule, together with the
+// EtherType the entry should carry.
+type aclLocation struct {
+	locationType string
+	locationID   string
+	etherType    string
+}
+
+// addressFamily detects whether cidr is an IPv4 or IPv6 network from its
+// string form, returning the VSD EtherType and network-macro IPType a peer
+// in that family should use.
+func addressFamily(cidr string) (etherType, ipType string) {
+	if strings.Contains(cidr, ":") {
+		return "0x86DD", "IPV6"
+	}
+	return "0x800", "IPV4"
+}
+
+// peerLocations resolves a NetworkPolicyPeer list to the VSD objects ACL
+// entries should scope to.  IPBlock peers become network macros, same as a
+// Service's ClusterIP does in HandleServiceEvent; the peer's own CIDR string
+// decides whether the macro - and the ACL entry that references it - is
+// IPv4 or IPv6, so a mix of v4 and v6 peers produces entries in both
+// families instead of nonsensical ones.  PodSelector and NamespaceSelector
+// peers are not resolved to pods or to the namespaces they select: each one
+// becomes the zone of the policy's own namespace, once per address family
+// the cluster carries.
+func (nvsdc *NuageVsdClient) peerLocations(namespace string, peers []networkingv1.NetworkPolicyPeer) ([]aclLocation, error) {
+	if len(peers) == 0 {
+		locations := make([]aclLocation, 0, len(nvsdc.etherTypes()))
+		for _, etherType := range nvsdc.etherTypes() {
+			locations = append(locations, aclLocation{locationType: "ANY", etherType: etherType})
+		}
+		return locations, nil
+	}
+	locations := make([]aclLocation, 0, len(peers))
+	for _, peer := range peers {
+		switch {
+		case peer.IPBlock != nil:
+			etherType, ipType := addressFamily(peer.IPBlock.CIDR)
+			var address, netmask string
+			if ipType == "IPV6" {
+				cidr, err := IPv6SubnetFromString(peer.IPBlock.CIDR)
+				if err != nil {
+					return nil, err
+				}
+				address, netmask = cidr.Address.String(), cidr.Netmask().String()
+			} else {
+				cidr, err := IPv4SubnetFromString(peer.IPBlock.CIDR)
+				if err != nil {
+					return nil, err
+				}
+				address, netmask = cidr.Address.String(), cidr.Netmask().String()
+			}
+			macro := &api.VsdNetworkMacro{
+				Name:    "NetworkPolicy peer " + peer.IPBlock.CIDR,
+				IPType:  ipType,
+				Address: address,
+				Netmask: netmask,
+			}
+			macroID, err := nvsdc.CreateNetworkMacro(nvsdc.enterpriseID, macro)
+			if err != nil {
+				return nil, err
+			}
+			locations = append(locations, aclLocation{locationType: "ENTERPRISE_NETWORK", locationID: macroID, etherType: etherType})
+		default:
+			peerZoneID := nvsdc.namespaces[namespace].ZoneID
+			glog.Warningf("NetworkPolicy peer selector in namespace %s isn't resolved to pod granularity yet; scoping to the namespace's zone", namespace)
+			for _, etherType := range nvsdc.etherTypes() {
+				locations = append(locations, aclLocation{locationType: "ZONE", locationID: peerZoneID, etherType: etherType})
+			}
+		}
+	}
+	return locations, nil
+}
+
+// ruleAclKey identifies one ACL entry a NetworkPolicy rule generates,
+// independent of its VSD ID or priority: two entries with the same key
+// describe the same (rule, peer, protocol, port) combination, and
+// reconcileRuleAclEntries uses that to recognize an unchanged rule across an
+// Update instead of deleting and recreating it.
+func ruleAclKey(ruleIdx int, loc aclLocation, rule aclRule) string {
+	return fmt.Sprintf("%d|%s|%s|%s|%s|%s", ruleIdx, loc.locationType, loc.locationID, loc.etherType, rule.protocol, rule.port)
+}
+
+// reconcileRuleAclEntries fills wanted with the ruleAclKey->aclID of every
+// ACL entry a single NetworkPolicyIngressRule/NetworkPolicyEgressRule (at
+// index ruleIdx in its policy) should produce: one per (peer location, port
+// rule) combination.  A key already present in existing - state's mapping
+// before this call - is copied into wanted as-is rather than recreated, so
+// an Update that only touches some rules only churns those rules' entries.
+func (nvsdc *NuageVsdClient) reconcileRuleAclEntries(ingress bool, namespace, description, policyGroupID string, ruleIdx int, podSelector *metav1.LabelSelector, ports []networkingv1.NetworkPolicyPort, peers []networkingv1.NetworkPolicyPeer, existing, wanted map[string]string) error {
+	templateID := nvsdc.egressAclTemplateID
+	if ingress {
+		templateID = nvsdc.ingressAclTemplateID
+	}
+	locations, err := nvsdc.peerLocations(namespace, peers)
+	if err != nil {
+		return err
+	}
+	for _, loc := range locations {
+		for _, rule := range nvsdc.expandPorts(namespace, podSelector, ports) {
+			key := ruleAclKey(ruleIdx, loc, rule)
+			if aclID, ok := existing[key]; ok {
+				wanted[key] = aclID
+				continue
+			}
+			// Every created entry needs its own priority - VSD requires
+			// unique priorities per template, and a multi-peer/multi-port
+			// rule (or, on a dual-stack cluster, any rule with no peers or
+			// with selector peers, for which peerLocations returns a v4+v6
+			// pair) produces more than one entry here.
+			priority := networkPolicyPriorityFloor + nvsdc.NextAvailablePriority()
+			aclEntry := api.VsdAclEntry{
+				Action:      "FORWARD",
+				Description: description,
+				EntityScope: "ENTERPRISE",
+				EtherType:   loc.etherType,
+				PolicyState: "LIVE",
+				Priority:    priority,
+				Protocol:    rule.protocol,
+				Reflexive:   false,
+			}
+			if ingress {
+				aclEntry.LocationType, aclEntry.LocationID = loc.locationType, loc.locationID
+				aclEntry.NetworkType, aclEntry.NetworkID = "POLICYGROUP", policyGroupID
+			} else {
+				aclEntry.LocationType, aclEntry.LocationID = "POLICYGROUP", policyGroupID
+				aclEntry.NetworkType, aclEntry.NetworkID = loc.locationType, loc.locationID
+			}
+			aclID, err := nvsdc.CreateAclEntry(templateID, ingress, &aclEntry)
+			if err != nil {
+				return err
+			}
+			wanted[key] = aclID
+		}
+	}
+	return nil
+}
+
+// reconcileNetworkPolicyAcls brings state's ingress and egress ACL entries
+// in line with policy's current spec: every rule is diffed independently
+// via reconcileRuleAclEntries, then whatever existed before this call and
+// isn't wanted anymore is deleted.  Called both by CreateNetworkPolicy,
+// where state starts out with no existing entries and everything is
+// created, and by UpdateNetworkPolicy, where most rules are usually
+// unchanged and only the delta is touched.
+func (nvsdc *NuageVsdClient) reconcileNetworkPolicyAcls(policy *networkingv1.NetworkPolicy, description string, state *networkPolicyState) error {
+	namespace := policy.Namespace
+	wantedIngress := make(map[string]string)
+	for i, rule := range policy.Spec.Ingress {
+		if err := nvsdc.reconcileRuleAclEntries(true, namespace, description, state.policyGroupID, i, &policy.Spec.PodSelector, rule.Ports, rule.From, state.ingressAcls, wantedIngress); err != nil {
+			return err
+		}
+	}
+	for key, aclID := range state.ingressAcls {
+		if _, stillWanted := wantedIngress[key]; stillWanted {
+			continue
+		}
+		if err := nvsdc.DeleteAclEntry(true, aclID); err != nil {
+			glog.Errorf("Error when deleting stale ingress ACL entry %s for NetworkPolicy: %s", aclID, err)
+			return err
+		}
+	}
+	state.ingressAcls = wantedIngress
+
+	wantedEgress := make(map[string]string)
+	for i, rule := range policy.Spec.Egress {
+		if err := nvsdc.reconcileRuleAclEntries(false, namespace, description, state.policyGroupID, i, &policy.Spec.PodSelector, rule.Ports, rule.To, state.egressAcls, wantedEgress); err != nil {
+			return err
+		}
+	}
+	for key, aclID := range state.egressAcls {
+		if _, stillWanted := wantedEgress[key]; stillWanted {
+			continue
+		}
+		if err := nvsdc.DeleteAclEntry(false, aclID); err != nil {
+			glog.Errorf("Error when deleting stale egress ACL entry %s for NetworkPolicy: %s", aclID, err)
+			return err
+		}
+	}
+	state.egressAcls = wantedEgress
+	return nil
+}
+
+/* CreateNetworkPolicy translates a Kubernetes NetworkPolicy into a VSD
+ * policy group plus one ingress/egress ACL entry per (rule, peer, port)
+ * combination.  The policy's own PodSelector isn't resolved to specific
+ * vports here - membership in the policy group has to be assigned per-pod
+ * as pods matching the selector come and go, which belongs with the rest
+ * of the pod lifecycle handling rather than here - so this only creates
+ * the policy group and its ACL entries, ready for pods to be added to it.
+ */
+// CreateNetworkPolicy takes nvsdc.mu for the duration of the call; see
+// NuageVsdClient.HandleNsEvent's doc comment for why.
+func (nvsdc *NuageVsdClient) CreateNetworkPolicy(policy *networkingv1.NetworkPolicy) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	return nvsdc.createNetworkPolicy(policy)
+}
+
+// createNetworkPolicy is CreateNetworkPolicy's body, unexported so
+// updateNetworkPolicy - which already holds nvsdc.mu by the time it falls
+// back to creating the policy - can call it directly instead of re-locking.
+func (nvsdc *NuageVsdClient) createNetworkPolicy(policy *networkingv1.NetworkPolicy) error {
+	namespace := policy.Namespace
+	if _, exists := nvsdc.namespaces[namespace]; !exists {
+		return errors.New(fmt.Sprintf(
+			"Cannot create NetworkPolicy %s/%s: namespace isn't synced yet", namespace, policy.Name))
+	}
+	key := networkPolicyKey(namespace, policy.Name)
+	if _, exists := nvsdc.networkPolicies[key]; exists {
+		return errors.New(fmt.Sprintf("NetworkPolicy %s already exists", key))
+	}
+	pgID, err := nvsdc.CreatePolicyGroup(nvsdc.domainID, policyGroupName(namespace, policy.Name))
+	if err != nil {
+		return err
+	}
+	state := &networkPolicyState{
+		policyGroupID: pgID,
+		podSelector:   &policy.Spec.PodSelector,
+		ingressAcls:   make(map[string]string),
+		egressAcls:    make(map[string]string),
+	}
+	description := "NetworkPolicy " + namespace + "/" + policy.Name
+	if err := nvsdc.reconcileNetworkPolicyAcls(policy, description, state); err != nil {
+		nvsdc.deleteNetworkPolicyState(state)
+		return err
+	}
+	if err := nvsdc.reconcileServiceAcls(namespace, policy.Name, &policy.Spec.PodSelector, state); err != nil {
+		nvsdc.deleteNetworkPolicyState(state)
+		return err
+	}
+	nvsdc.networkPolicies[key] = state
+	return nil
+}
+
+// UpdateNetworkPolicy brings namespace/policy.Name's VSD state in line with
+// policy's current spec, creating it via CreateNetworkPolicy if this is the
+// first event seen for it.  Unlike the old delete-everything-then-recreate
+// approach, reconcileNetworkPolicyAcls and reconcileServiceAcls each diff
+// the desired state against what's already there, so an Update whose spec
+// didn't actually change any given rule leaves that rule's ACL entries - and
+// their VSD IDs - untouched.
+func (nvsdc *NuageVsdClient) UpdateNetworkPolicy(policy *networkingv1.NetworkPolicy) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	key := networkPolicyKey(policy.Namespace, policy.Name)
+	state, exists := nvsdc.networkPolicies[key]
+	if !exists {
+		return nvsdc.createNetworkPolicy(policy)
+	}
+	state.podSelector = &policy.Spec.PodSelector
+	description := "NetworkPolicy " + policy.Namespace + "/" + policy.Name
+	if err := nvsdc.reconcileNetworkPolicyAcls(policy, description, state); err != nil {
+		return err
+	}
+	return nvsdc.reconcileServiceAcls(policy.Namespace, policy.Name, state.podSelector, state)
+}
+
+// DeleteNetworkPolicy removes only the ACL entries and policy group that
+// CreateNetworkPolicy created for namespace/name, leaving every other
+// policy's rules untouched.
+func (nvsdc *NuageVsdClient) DeleteNetworkPolicy(namespace, name string) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	key := networkPolicyKey(namespace, name)
+	state, exists := nvsdc.networkPolicies[key]
+	if !exists {
+		glog.Warningf("Got delete event for unknown NetworkPolicy %s", key)
+		return nil
+	}
+	if err := nvsdc.deleteNetworkPolicyState(state); err != nil {
+		return err
+	}
+	delete(nvsdc.networkPolicies, key)
+	return nil
+}
+
+func (nvsdc *NuageVsdClient) deleteNetworkPolicyState(state *networkPolicyState) error {
+	for _, aclID := range state.ingressAcls {
+		if err := nvsdc.DeleteAclEntry(true, aclID); err != nil && !IsNotFound(err) {
+			glog.Errorf("Error when deleting ingress ACL entry %s for NetworkPolicy: %s", aclID, err)
+			return err
+		}
+	}
+	for _, aclID := range state.egressAcls {
+		if err := nvsdc.DeleteAclEntry(false, aclID); err != nil && !IsNotFound(err) {
+			glog.Errorf("Error when deleting egress ACL entry %s for NetworkPolicy: %s", aclID, err)
+			return err
+		}
+	}
+	if err := nvsdc.deleteServiceAcls(state); err != nil {
+		return err
+	}
+	if state.policyGroupID != "" {
+		if err := nvsdc.DeletePolicyGroup(state.policyGroupID); err != nil && !IsNotFound(err) {
+			glog.Errorf("Error when deleting policy group %s for NetworkPolicy: %s", state.policyGroupID, err)
+			return err
+		}
+	}
+	return nil
+}
@@ -18,6 +18,7 @@
 package client
 
 import (
+	"context"
 	"crypto/sha1"
 	"crypto/tls"
 	"encoding/base64"
@@ -30,34 +31,91 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 type NuageVsdClient struct {
-	url          string
-	version      string
-	username     string
-	password     string
-	enterprise   string
-	session      napping.Session
-	enterpriseID string
-	domainID     string
-	zones        map[string]string      //project name -> zone id mapping
-	subnets      map[string]*SubnetList //zone id -> list of subnets mapping
-	pool         IPv4SubnetPool
-	subnetSize   int //the size in bits of the subnets we allocate (i.e. size 8 produces /24 subnets).
+	// mu guards every field below that Controller's namespace/service/
+	// networkpolicy workers and reconcileDrift can reach concurrently - the
+	// maps, nextAvailablePriority, and session.Header, which Add/Del calls
+	// scattered across this file mutate for the duration of a single REST
+	// call. Each exported entry point Controller calls from a worker
+	// goroutine (HandleNsEvent, HandleServiceEvent, CreateNetworkPolicy,
+	// UpdateNetworkPolicy, DeleteNetworkPolicy, ReconcileZones,
+	// ReconcileStore, CheckZoneSubnetCapacity) takes mu for its entire body,
+	// so VSD calls made from different workers never interleave; it
+	// delegates to an unexported sibling where it needs to call another
+	// locked entry point itself instead of re-locking.
+	mu                    sync.Mutex
+	url                   string
+	version               string
+	username              string
+	password              string
+	enterprise            string
+	session               napping.Session
+	enterpriseID          string
+	domainID              string
+	ingressAclTemplateID  string
+	egressAclTemplateID   string
+	zones                 map[string]string              //project name -> zone id mapping
+	subnets               map[string]*SubnetList         //zone id -> list of subnets mapping
+	namespaces            map[string]NamespaceData       //namespace name -> VSD resources created for it
+	networkPolicies       map[string]*networkPolicyState //namespace/name -> ACL resources created for it
+	services              map[string]serviceInfo         //namespace/name -> last known Service selector/ClusterIP/NodePort
+	namedPorts            *NamedPortCache
+	pool                  IPv4SubnetPool
+	poolV6                *IPv6SubnetPool
+	subnetSize            int //the size in bits of the subnets we allocate (i.e. size 8 produces /24 subnets).
+	subnetSizeV6          int //the size in bits of the IPv6 subnets we allocate (i.e. size 64 produces /64 subnets, same convention as subnetSize).
+	ipv4Enabled           bool
+	ipv6Enabled           bool
+	nextAvailablePriority int
+	reqPool               *vsdRequestPool      // bounds concurrency and retries for CreateDomain/CreateZone/CreateSubnet/CreateNetworkMacro/CreateAclEntry and coalesces GetZoneID
+	orphanZones           map[string]time.Time // zone name -> when ReconcileZones first saw it with no matching namespace
+	orphanGracePeriod     time.Duration
+	eventRecorder         record.EventRecorder // set via SetEventRecorder; nil until then, in which case failures are only glogged
+	ctx                   context.Context      // cancelled by Shutdown; passed to the XxxCtx sibling of every REST call this client's non-Ctx methods make
+	cancel                context.CancelFunc
+	transport             *ctxTransport // session.Client's RoundTripper; ctxVsdRequest points it at the context.Context each call was given, so cancelling that context actually aborts the in-flight HTTP request instead of just unblocking the caller
+	store                 *vsdStore     // persists zone/network-macro/network-macro-group IDs so ReconcileStore can find them again after a restart
 }
 
+// SubnetList tracks the subnets allocated to a zone.  A dual-stack entry has
+// both Subnet and SubnetV6 populated but a single SubnetID, since VSD models
+// a dual-stack subnet as one object with both an IPv4 and an IPv6 side.
 type SubnetList struct {
 	SubnetID string
 	Subnet   *IPv4Subnet
+	SubnetV6 *IPv6Subnet
 	Next     *SubnetList
 }
 
+// NamespaceData tracks the VSD resources nuagekubemon has created on behalf
+// of a Kubernetes namespace, so they can be looked up and cleaned up again
+// without re-querying the VSD.
+type NamespaceData struct {
+	ZoneID              string
+	NetworkMacroGroupID string
+	NetworkMacros       map[string]string //service name -> network macro ID
+	UID                 string            // the Kubernetes namespace's UID, so a Delete for a namespace recreated with the same name doesn't tear down the new namespace's zone/network macro group
+}
+
 const clusterEnterpriseName = "K8S-Enterprise"
 const clusterDomainTemplateName = "K8S-Domain-Template"
 const clusterDomainName = "K8S-Domain"
 
-func NewNuageVsdClient(nkmConfig *config.NuageKubeMonConfig) *NuageVsdClient {
+// defaultOrphanGracePeriod is how long ReconcileZones waits after first
+// seeing a zone with no matching namespace before deleting it, so a Resync
+// that races a namespace's own Add event - or one that runs against a
+// momentarily stale informer cache - doesn't delete a zone out from under a
+// namespace that's still there.
+const defaultOrphanGracePeriod = 10 * time.Minute
+
+func NewNuageVsdClient(nkmConfig *config.NuageKubeMonConfig) VsdAPI {
 	nvsdc := new(NuageVsdClient)
 	nvsdc.Init(nkmConfig)
 	return nvsdc
@@ -273,11 +331,14 @@ func (nvsdc *NuageVsdClient) CreateSession() {
 	nvsdc.username = "csproot"
 	nvsdc.password = "csproot"
 	nvsdc.enterprise = "csp"
+	nvsdc.transport = &ctxTransport{
+		base: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
 	nvsdc.session = napping.Session{
 		Client: &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
+			Transport: nvsdc.transport,
 		},
 		Header: &http.Header{},
 	}
@@ -297,75 +358,95 @@ func (nvsdc *NuageVsdClient) LoginAsAdmin(user, password, enterpriseName string)
 func (nvsdc *NuageVsdClient) Init(nkmConfig *config.NuageKubeMonConfig) {
 	nvsdc.version = nkmConfig.NuageVspVersion
 	nvsdc.url = nkmConfig.NuageVsdApiUrl + "/nuage/api/" + nvsdc.version + "/"
-	ipPool, err := IPv4SubnetFromString(nkmConfig.OsMasterConfig.NetworkConfig.ClusterCIDR)
+	ipPool, ipPoolV6, err := parseSubnetPools(nkmConfig.SubnetPools)
 	if err != nil {
 		glog.Fatalf("Failure in init: %s\n", err)
 	}
-	nvsdc.subnetSize = nkmConfig.OsMasterConfig.NetworkConfig.SubnetLength
-	if nvsdc.subnetSize < 0 || nvsdc.subnetSize > 32 {
-		glog.Errorf("Invalid hostSubnetLength of %d.  Using default value of 8",
-			nvsdc.subnetSize)
-		nvsdc.subnetSize = 8
-	}
-	if nvsdc.subnetSize > (32 - ipPool.CIDRMask) {
-		// If the size of the subnet (in bits) is larger than the total pool
-		// size (in bits), we can't even allocate 1 subnet.  Default to using
-		// half the remaining bits per subnet, rounded down (/24 has 8 bits
-		// remaining, so use 4 bits per subnet).
-		newSize := (32 - ipPool.CIDRMask) / 2
-		glog.Fatalf("Cannot allocate %d bit subnets from %s.  Using %d bits per subnet.",
-			nvsdc.subnetSize, ipPool.String(), newSize)
-		nvsdc.subnetSize = newSize
-	}
-	// A null IPv4SubnetPool acts like all addresses are allocated, so we can
-	// initialize it to have the available cluster address space by just
-	// Free()-ing it.
-	nvsdc.pool.Free(ipPool)
+	if ipPool != nil {
+		nvsdc.subnetSize = nkmConfig.SubnetSize
+		if nvsdc.subnetSize < 0 || nvsdc.subnetSize > 32 {
+			glog.Errorf("Invalid SubnetSize of %d.  Using default value of 8",
+				nvsdc.subnetSize)
+			nvsdc.subnetSize = 8
+		}
+		if nvsdc.subnetSize > (32 - ipPool.CIDRMask) {
+			// If the size of the subnet (in bits) is larger than the total pool
+			// size (in bits), we can't even allocate 1 subnet.  Default to using
+			// half the remaining bits per subnet, rounded down (/24 has 8 bits
+			// remaining, so use 4 bits per subnet).
+			newSize := (32 - ipPool.CIDRMask) / 2
+			glog.Fatalf("Cannot allocate %d bit subnets from %s.  Using %d bits per subnet.",
+				nvsdc.subnetSize, ipPool.String(), newSize)
+			nvsdc.subnetSize = newSize
+		}
+		// A null IPv4SubnetPool acts like all addresses are allocated, so we can
+		// initialize it to have the available cluster address space by just
+		// Free()-ing it.
+		nvsdc.pool.Free(ipPool)
+		nvsdc.ipv4Enabled = true
+	}
+	if ipPoolV6 != nil {
+		nvsdc.subnetSizeV6 = nkmConfig.SubnetSizeV6
+		if nvsdc.subnetSizeV6 < 0 || nvsdc.subnetSizeV6 > 128 {
+			glog.Errorf("Invalid SubnetSizeV6 of %d.  Using default value of 64",
+				nvsdc.subnetSizeV6)
+			nvsdc.subnetSizeV6 = 64
+		}
+		if nvsdc.subnetSizeV6 > (128 - ipPoolV6.CIDRMask) {
+			newSize := (128 - ipPoolV6.CIDRMask) / 2
+			glog.Fatalf("Cannot allocate %d bit subnets from %s.  Using %d bits per subnet.",
+				nvsdc.subnetSizeV6, ipPoolV6.String(), newSize)
+			nvsdc.subnetSizeV6 = newSize
+		}
+		nvsdc.poolV6 = NewIPv6SubnetPool()
+		nvsdc.poolV6.Free(ipPoolV6)
+		nvsdc.ipv6Enabled = true
+	}
+	nvsdc.ctx, nvsdc.cancel = context.WithCancel(context.Background())
 	nvsdc.namespaces = make(map[string]NamespaceData)
 	nvsdc.subnets = make(map[string]*SubnetList)
+	nvsdc.networkPolicies = make(map[string]*networkPolicyState)
+	nvsdc.services = make(map[string]serviceInfo)
+	nvsdc.namedPorts = NewNamedPortCache()
 	nvsdc.CreateSession()
 	nvsdc.nextAvailablePriority = 0
-
-	err = nvsdc.GetAuthorizationToken()
-	if err != nil {
-		glog.Fatal(err)
+	nvsdc.reqPool = newVsdRequestPool(nkmConfig.VsdConcurrency, nkmConfig.VsdMaxRetries, nkmConfig.VsdBackoff)
+	nvsdc.orphanZones = make(map[string]time.Time)
+	nvsdc.orphanGracePeriod = nkmConfig.OrphanGracePeriod
+	if nvsdc.orphanGracePeriod <= 0 {
+		nvsdc.orphanGracePeriod = defaultOrphanGracePeriod
 	}
-	nvsdc.enterpriseID, err = nvsdc.CreateEnterprise(clusterEnterpriseName)
-	if err != nil {
-		glog.Fatal(err)
-	}
-	_, err = nvsdc.CreateAdminUser(nvsdc.enterpriseID, "admin", "admin")
-	if err != nil {
-		glog.Fatal(err)
+	storePath := nkmConfig.VsdStorePath
+	if storePath == "" {
+		storePath = defaultVsdStorePath
 	}
-	err = nvsdc.InstallLicense(nkmConfig.LicenseFile)
+	nvsdc.store, err = newVsdStore(storePath)
 	if err != nil {
-		glog.Fatal(err)
-	}
-	err = nvsdc.LoginAsAdmin("admin", "admin", clusterEnterpriseName)
-	if err != nil {
-		glog.Fatal(err)
-	}
-	domainTemplateID, err := nvsdc.CreateDomainTemplate(nvsdc.enterpriseID,
-		clusterDomainTemplateName)
-	if err != nil {
-		glog.Fatal(err)
+		glog.Fatalf("Failure in init: %s\n", err)
 	}
-	nvsdc.domainID, err = nvsdc.CreateDomain(nvsdc.enterpriseID,
-		domainTemplateID, clusterDomainName)
-	if err != nil {
-		glog.Fatal(err)
+	if nkmConfig.MetricsListenAddr != "" {
+		nvsdc.ServeMetrics(nkmConfig.MetricsListenAddr)
 	}
-	_, err = nvsdc.CreateIngressAclTemplate(nvsdc.domainID)
+
+	err = nvsdc.GetAuthorizationToken()
 	if err != nil {
 		glog.Fatal(err)
 	}
-	_, err = nvsdc.CreateEgressAclTemplate(nvsdc.domainID)
+	nvsdc.enterpriseID, nvsdc.domainID, err = bootstrapCluster(nvsdc, nkmConfig)
 	if err != nil {
 		glog.Fatal(err)
 	}
 }
 
+// Shutdown cancels the context passed to every XxxCtx VSD REST call this
+// client's non-Ctx methods make, so a Controller can unblock any in-flight
+// network-macro/macro-group calls when the reconcile loop that started them
+// is torn down. It's a Controller-lifetime signal, not a per-call one - it
+// only needs to be called once, from Controller.Run's shutdown path.
+func (nvsdc *NuageVsdClient) Shutdown() {
+	nvsdc.cancel()
+}
+
 func (nvsdc *NuageVsdClient) InstallLicense(licensePath string) error {
 	if licensePath == "" {
 		glog.Error("No license file specified")
@@ -537,62 +618,86 @@ func (nvsdc *NuageVsdClient) GetEgressAclTemplateID(domainID, name string) (stri
 	}
 }
 
+// etherTypes returns the VSD EtherType values this cluster's zones carry
+// traffic for: IPv4 always, plus IPv6 once SubnetPools includes an IPv6
+// CIDR.  Callers that install one ACL entry per address family (the
+// intra-zone allow/intra-domain drop pair, zone-to-service entries, etc.)
+// range over this instead of hardcoding "0x800".
+func (nvsdc *NuageVsdClient) etherTypes() []string {
+	if nvsdc.ipv6Enabled {
+		return []string{"0x800", "0x86DD"}
+	}
+	return []string{"0x800"}
+}
+
+// etherTypeSuffix distinguishes the IPv6 half of a duplicated ACL entry in
+// its Description, since GetAclEntry/DeleteAclEntry look entries up by
+// Description alone.
+func etherTypeSuffix(etherType string) string {
+	if etherType == "0x86DD" {
+		return " (IPv6)"
+	}
+	return ""
+}
+
 func (nvsdc *NuageVsdClient) CreateIngressAclEntries() error {
-	aclEntry := api.VsdAclEntry{
-		Action:       "FORWARD",
-		Description:  "Allow Intra-Zone Traffic",
-		EntityScope:  "ENTERPRISE",
-		EtherType:    "0x800",
-		LocationType: "ANY",
-		NetworkType:  "ENDPOINT_ZONE",
-		PolicyState:  "LIVE",
-		Priority:     0,
-		Protocol:     "ANY",
-		Reflexive:    false,
-	}
-	_, err := nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating ingress acl entry", err)
-		return err
-	}
-	aclEntry.Action = "DROP"
-	aclEntry.Description = "Drop intra-domain traffic"
-	aclEntry.EtherType = "0x800"
-	aclEntry.NetworkType = "ENDPOINT_DOMAIN"
-	aclEntry.Priority = 1000000000 //the maximum priority allowed in VSD is 1 billion.
-	_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating ingress acl entry", err)
+	for i, etherType := range nvsdc.etherTypes() {
+		aclEntry := api.VsdAclEntry{
+			Action:       "FORWARD",
+			Description:  "Allow Intra-Zone Traffic" + etherTypeSuffix(etherType),
+			EntityScope:  "ENTERPRISE",
+			EtherType:    etherType,
+			LocationType: "ANY",
+			NetworkType:  "ENDPOINT_ZONE",
+			PolicyState:  "LIVE",
+			Priority:     i,
+			Protocol:     "ANY",
+			Reflexive:    false,
+		}
+		_, err := nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating ingress acl entry", err)
+			return err
+		}
+		aclEntry.Action = "DROP"
+		aclEntry.Description = "Drop intra-domain traffic" + etherTypeSuffix(etherType)
+		aclEntry.NetworkType = "ENDPOINT_DOMAIN"
+		aclEntry.Priority = 1000000000 - i //the maximum priority allowed in VSD is 1 billion.
+		_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating ingress acl entry", err)
+		}
 	}
 	return nil
 }
 
 func (nvsdc *NuageVsdClient) CreateEgressAclEntries() error {
-	aclEntry := api.VsdAclEntry{
-		Action:       "FORWARD",
-		Description:  "Allow Intra-Zone Traffic",
-		EntityScope:  "ENTERPRISE",
-		EtherType:    "0x800",
-		LocationType: "ANY",
-		NetworkType:  "ENDPOINT_ZONE",
-		PolicyState:  "LIVE",
-		Priority:     0,
-		Protocol:     "ANY",
-		Reflexive:    false,
-	}
-	_, err := nvsdc.CreateAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating egress acl entry", err)
-		return err
-	}
-	aclEntry.Action = "DROP"
-	aclEntry.Description = "Drop intra-domain traffic"
-	aclEntry.EtherType = "0x800"
-	aclEntry.NetworkType = "ENDPOINT_DOMAIN"
-	aclEntry.Priority = 1000000000 //the maximum priority allowed in VSD is 1 billion.
-	_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, false, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating egress acl entry", err)
+	for i, etherType := range nvsdc.etherTypes() {
+		aclEntry := api.VsdAclEntry{
+			Action:       "FORWARD",
+			Description:  "Allow Intra-Zone Traffic" + etherTypeSuffix(etherType),
+			EntityScope:  "ENTERPRISE",
+			EtherType:    etherType,
+			LocationType: "ANY",
+			NetworkType:  "ENDPOINT_ZONE",
+			PolicyState:  "LIVE",
+			Priority:     i,
+			Protocol:     "ANY",
+			Reflexive:    false,
+		}
+		_, err := nvsdc.CreateAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating egress acl entry", err)
+			return err
+		}
+		aclEntry.Action = "DROP"
+		aclEntry.Description = "Drop intra-domain traffic" + etherTypeSuffix(etherType)
+		aclEntry.NetworkType = "ENDPOINT_DOMAIN"
+		aclEntry.Priority = 1000000000 - i //the maximum priority allowed in VSD is 1 billion.
+		_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, false, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating egress acl entry", err)
+		}
 	}
 	return nil
 }
@@ -678,11 +783,79 @@ func (nvsdc *NuageVsdClient) CreateEgressAclTemplate(domainID string) (string, e
 		}
 		return nvsdc.egressAclTemplateID, nil
 	default:
-		glog.Errorln("Bad response status from VSD Server")
-		glog.Errorf("\t Raw Text:\n%v\n", resp.RawText())
-		glog.Errorf("\t Status:  %v\n", resp.Status())
-		glog.Errorf("\t Internal error code: %v\n", e.InternalErrorCode)
-		return errors.New("Unexpected error code: " + fmt.Sprintf("%v", resp.Status()))
+		return "", VsdErrorResponse(resp, &e)
+	}
+}
+
+func (nvsdc *NuageVsdClient) CreateAclEntry(templateID string, ingress bool, aclEntry *api.VsdAclEntry) (string, error) {
+	result := make([]api.VsdAclEntry, 1)
+	e := api.RESTError{}
+	url := nvsdc.url + "egressacltemplates/" + templateID + "/egressaclentrytemplates"
+	if ingress {
+		url = nvsdc.url + "ingressacltemplates/" + templateID + "/ingressaclentrytemplates"
+	}
+	resp, err := instrumentVsdRequest("create_acl_entry", "acl_entry", func() (*napping.Response, error) {
+		return nvsdc.reqPool.do(func() (*napping.Response, error) {
+			return nvsdc.session.Post(url, aclEntry, &result, &e)
+		})
+	})
+	if err != nil {
+		glog.Error("Error when creating acl entry", err)
+		return "", err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when creating acl entry")
+	switch resp.Status() {
+	case 201:
+		glog.Infoln("Created the acl entry:", result[0].ID)
+		return result[0].ID, nil
+	case 409:
+		//Acl entry already exists, call Get to retrieve the ID
+		acl, err := nvsdc.GetAclEntry(templateID, ingress, aclEntry)
+		if err != nil {
+			glog.Errorf("Error when getting acl entry: %s", err)
+			return "", err
+		}
+		if acl == nil {
+			return "", errors.New("Acl entry reported as existing, but could not be found")
+		}
+		return acl.ID, nil
+	default:
+		return "", VsdErrorResponse(resp, &e)
+	}
+}
+
+func (nvsdc *NuageVsdClient) GetAclEntry(templateID string, ingress bool, aclEntry *api.VsdAclEntry) (*api.VsdAclEntry, error) {
+	result := make([]api.VsdAclEntry, 1)
+	h := nvsdc.session.Header
+	h.Add("X-Nuage-Filter", `description == "`+aclEntry.Description+`"`)
+	e := api.RESTError{}
+	url := nvsdc.url + "egressacltemplates/" + templateID + "/egressaclentrytemplates"
+	if ingress {
+		url = nvsdc.url + "ingressacltemplates/" + templateID + "/ingressaclentrytemplates"
+	}
+	resp, err := instrumentVsdRequest("get_acl_entry", "acl_entry", func() (*napping.Response, error) {
+		return nvsdc.session.Get(url, nil, &result, &e)
+	})
+	h.Del("X-Nuage-Filter")
+	if err != nil {
+		glog.Errorf("Error when getting acl entry %s", err)
+		return nil, err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when getting acl entry")
+	if resp.Status() == 200 {
+		// Status code 200 is returned even if there's no results.  If
+		// the filter didn't match anything (or there was nothing to
+		// return), the result object will just be empty.
+		if result[0].Description == aclEntry.Description {
+			return &result[0], nil
+		} else if result[0].Description == "" {
+			return nil, nil
+		} else {
+			return nil, errors.New(fmt.Sprintf(
+				"Found %q instead of %q", result[0].Description, aclEntry.Description))
+		}
+	} else {
+		return nil, VsdErrorResponse(resp, &e)
 	}
 }
 
@@ -694,7 +867,9 @@ func (nvsdc *NuageVsdClient) DeleteAclEntry(ingress bool, aclID string) error {
 	if ingress {
 		url = nvsdc.url + "ingressaclentrytemplates/" + aclID + "?responseChoice=1"
 	}
-	resp, err := nvsdc.session.Delete(url, &result, &e)
+	resp, err := instrumentVsdRequest("delete_acl_entry", "acl_entry", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(url, &result, &e)
+	})
 	if err != nil {
 		glog.Errorf("Error when deleting acl with ID %s: %s", aclID, err)
 		return err
@@ -704,28 +879,35 @@ func (nvsdc *NuageVsdClient) DeleteAclEntry(ingress bool, aclID string) error {
 	case 204:
 		return nil
 	default:
-		glog.Errorln("Bad response status from VSD Server")
-		glog.Errorf("\t Raw Text:\n%v\n", resp.RawText())
-		glog.Errorf("\t Status:  %v\n", resp.Status())
-		glog.Errorf("\t Message: %v\n", e.Message)
-		glog.Errorf("\t Errors: %v\n", e.Message)
-		return errors.New("Unexpected error code: " + fmt.Sprintf("%v", resp.Status()))
+		return VsdErrorResponse(resp, &e)
 	}
 }
 
+// GetZoneID looks up domainID/name's zone ID.  A NamespaceEvent replay at
+// startup can call this for the same domain/name pair many times before the
+// first lookup returns, so the lookup itself is coalesced across concurrent
+// callers sharing that pair via reqPool.coalesce - only one actually hits
+// the VSD, and every caller gets its (id, error).
 func (nvsdc *NuageVsdClient) GetZoneID(domainID, name string) (string, error) {
-	result := make([]api.VsdObject, 1)
-	h := nvsdc.session.Header
-	h.Add("X-Nuage-Filter", `name == "`+name+`"`)
-	e := api.RESTError{}
-	resp, err := nvsdc.session.Get(nvsdc.url+"domains/"+domainID+"/zones", nil, &result, &e)
-	h.Del("X-Nuage-Filter")
-	if err != nil {
-		glog.Errorf("Error when getting zone ID %s", err)
-		return "", err
-	}
-	glog.Infoln("Got a reponse status", resp.Status(), "when getting zone ID")
-	if resp.Status() == 200 {
+	v, err := nvsdc.reqPool.coalesce(domainID+"/"+name, func() (interface{}, error) {
+		result := make([]api.VsdObject, 1)
+		h := nvsdc.session.Header
+		h.Add("X-Nuage-Filter", `name == "`+name+`"`)
+		e := api.RESTError{}
+		resp, err := instrumentVsdRequest("get_zone_id", "zone", func() (*napping.Response, error) {
+			return nvsdc.reqPool.do(func() (*napping.Response, error) {
+				return nvsdc.session.Get(nvsdc.url+"domains/"+domainID+"/zones", nil, &result, &e)
+			})
+		})
+		h.Del("X-Nuage-Filter")
+		if err != nil {
+			glog.Errorf("Error when getting zone ID %s", err)
+			return "", err
+		}
+		glog.Infoln("Got a reponse status", resp.Status(), "when getting zone ID")
+		if resp.Status() != 200 {
+			return "", VsdErrorResponse(resp, &e)
+		}
 		// Status code 200 is returned even if there's no results.  If
 		// the filter didn't match anything (or there was nothing to
 		// return), the result object will just be empty.
@@ -733,13 +915,38 @@ func (nvsdc *NuageVsdClient) GetZoneID(domainID, name string) (string, error) {
 			return result[0].ID, nil
 		} else if result[0].Name == "" {
 			return "", errors.New("Zone not found")
-		} else {
-			return "", errors.New(fmt.Sprintf(
-				"Found %q instead of %q", result[0].Name, name))
 		}
-	} else {
-		return "", VsdErrorResponse(resp, &e)
+		return "", errors.New(fmt.Sprintf("Found %q instead of %q", result[0].Name, name))
+	})
+	id, _ := v.(string)
+	return id, err
+}
+
+// ListZoneNames returns the name of every zone under domainID, unfiltered -
+// unlike GetZoneID, which looks up a single zone by name.  ReconcileZones
+// uses it to find VSD zones nothing in the Controller's current namespace
+// set accounts for.
+func (nvsdc *NuageVsdClient) ListZoneNames(domainID string) ([]string, error) {
+	var result []api.VsdObject
+	e := api.RESTError{}
+	resp, err := instrumentVsdRequest("list_zones", "zone", func() (*napping.Response, error) {
+		return nvsdc.reqPool.do(func() (*napping.Response, error) {
+			return nvsdc.session.Get(nvsdc.url+"domains/"+domainID+"/zones", nil, &result, &e)
+		})
+	})
+	if err != nil {
+		glog.Errorf("Error when listing zones: %s", err)
+		return nil, err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when listing zones")
+	if resp.Status() != 200 {
+		return nil, VsdErrorResponse(resp, &e)
+	}
+	names := make([]string, 0, len(result))
+	for _, zone := range result {
+		names = append(names, zone.Name)
 	}
+	return names, nil
 }
 
 func (nvsdc *NuageVsdClient) CreateDomain(enterpriseID, domainTemplateID, name string) (string, error) {
@@ -751,7 +958,11 @@ func (nvsdc *NuageVsdClient) CreateDomain(enterpriseID, domainTemplateID, name s
 		PATEnabled:  api.PATEnabled,
 	}
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Post(nvsdc.url+"enterprises/"+enterpriseID+"/domains", &payload, &result, &e)
+	resp, err := instrumentVsdRequest("create_domain", "domain", func() (*napping.Response, error) {
+		return nvsdc.reqPool.do(func() (*napping.Response, error) {
+			return nvsdc.session.Post(nvsdc.url+"enterprises/"+enterpriseID+"/domains", &payload, &result, &e)
+		})
+	})
 	if err != nil {
 		glog.Error("Error when creating domain", err)
 		return "", err
@@ -778,7 +989,9 @@ func (nvsdc *NuageVsdClient) CreateDomain(enterpriseID, domainTemplateID, name s
 func (nvsdc *NuageVsdClient) DeleteDomain(id string) error {
 	result := make([]struct{}, 1)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Delete(nvsdc.url+"domains/"+id+"?responseChoice=1", &result, &e)
+	resp, err := instrumentVsdRequest("delete_domain", "domain", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(nvsdc.url+"domains/"+id+"?responseChoice=1", &result, &e)
+	})
 	if err != nil {
 		glog.Errorf("Error when deleting domain with ID %s: %s", id, err)
 		return err
@@ -799,7 +1012,11 @@ func (nvsdc *NuageVsdClient) CreateZone(domainID, name string) (string, error) {
 		Description: "Auto-generated for OpenShift project \"" + name + "\"",
 	}
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Post(nvsdc.url+"domains/"+domainID+"/zones", &payload, &result, &e)
+	resp, err := instrumentVsdRequest("create_zone", "zone", func() (*napping.Response, error) {
+		return nvsdc.reqPool.do(func() (*napping.Response, error) {
+			return nvsdc.session.Post(nvsdc.url+"domains/"+domainID+"/zones", &payload, &result, &e)
+		})
+	})
 	if err != nil {
 		glog.Error("Error when creating zone", err)
 		return "", err
@@ -827,7 +1044,9 @@ func (nvsdc *NuageVsdClient) DeleteZone(id string) error {
 	// Delete subnets in this zone
 	result := make([]struct{}, 1)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Delete(nvsdc.url+"zones/"+id+"?responseChoice=1", &result, &e)
+	resp, err := instrumentVsdRequest("delete_zone", "zone", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(nvsdc.url+"zones/"+id+"?responseChoice=1", &result, &e)
+	})
 	if err != nil {
 		glog.Errorf("Error when deleting zone with ID %s: %s", id, err)
 		return err
@@ -841,18 +1060,49 @@ func (nvsdc *NuageVsdClient) DeleteZone(id string) error {
 	}
 }
 
-func (nvsdc *NuageVsdClient) CreateSubnet(name, zoneID string, subnet *IPv4Subnet) (string, error) {
-	result := make([]api.VsdSubnet, 1)
+// CreateSubnet creates a VSD subnet in zoneID from one or two IPSubnets - one
+// IPv4Subnet for an "IPV4" subnet, one IPv6Subnet for an "IPV6" subnet, or
+// one of each for a "DUALSTACK" subnet with both Address/Netmask and
+// IPv6Address/IPv6Netmask populated on the same VSD object.
+func (nvsdc *NuageVsdClient) CreateSubnet(name, zoneID string, subnets ...IPSubnet) (string, error) {
 	payload := api.VsdSubnet{
-		IPType:      "IPV4",
-		Address:     subnet.Address.String(),
-		Netmask:     subnet.Netmask().String(),
 		Description: "Auto-generated subnet",
 		Name:        name,
 		PATEnabled:  api.PATInherited,
 	}
+	var v4, v6 IPSubnet
+	for _, s := range subnets {
+		if s.vsdIPType() == "IPV6" {
+			v6 = s
+		} else {
+			v4 = s
+		}
+	}
+	switch {
+	case v4 != nil && v6 != nil:
+		payload.IPType = "DUALSTACK"
+	case v6 != nil:
+		payload.IPType = "IPV6"
+	case v4 != nil:
+		payload.IPType = "IPV4"
+	default:
+		return "", errors.New("CreateSubnet needs at least one IPv4Subnet or IPv6Subnet")
+	}
+	if v4 != nil {
+		payload.Address = v4.addressString()
+		payload.Netmask = v4.netmaskString()
+	}
+	if v6 != nil {
+		payload.IPv6Address = v6.addressString()
+		payload.IPv6Netmask = v6.netmaskString()
+	}
+	result := make([]api.VsdSubnet, 1)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Post(nvsdc.url+"zones/"+zoneID+"/subnets", &payload, &result, &e)
+	resp, err := instrumentVsdRequest("create_subnet", "subnet", func() (*napping.Response, error) {
+		return nvsdc.reqPool.do(func() (*napping.Response, error) {
+			return nvsdc.session.Post(nvsdc.url+"zones/"+zoneID+"/subnets", &payload, &result, &e)
+		})
+	})
 	if err != nil {
 		glog.Error("Error when creating subnet", err)
 		return "", err
@@ -863,7 +1113,7 @@ func (nvsdc *NuageVsdClient) CreateSubnet(name, zoneID string, subnet *IPv4Subne
 		glog.Infoln("Created the subnet:", result[0].ID)
 	case 409:
 		//Subnet already exists, call Get to retrieve the ID
-		if id, err := nvsdc.GetSubnetID(zoneID, subnet); err != nil {
+		if id, err := nvsdc.GetSubnetID(zoneID, subnets...); err != nil {
 			glog.Errorf("Error when getting subnet ID: %s", err)
 			return "", err
 		} else {
@@ -878,7 +1128,9 @@ func (nvsdc *NuageVsdClient) CreateSubnet(name, zoneID string, subnet *IPv4Subne
 func (nvsdc *NuageVsdClient) DeleteSubnet(id string) error {
 	result := make([]struct{}, 1)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Delete(nvsdc.url+"subnets/"+id+"?responseChoice=1", &result, &e)
+	resp, err := instrumentVsdRequest("delete_subnet", "subnet", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(nvsdc.url+"subnets/"+id+"?responseChoice=1", &result, &e)
+	})
 	if err != nil {
 		glog.Errorf("Error when deleting subnet with ID %s: %s", id, err)
 		return err
@@ -890,19 +1142,46 @@ func (nvsdc *NuageVsdClient) DeleteSubnet(id string) error {
 	return nil
 }
 
-func (nvsdc *NuageVsdClient) GetSubnetID(zoneID string, subnet *IPv4Subnet) (string, error) {
+// GetSubnetID looks up the VSD subnet in zoneID matching subnets - filtered
+// on the IPv4 address when an IPv4Subnet is given (the common case, and the
+// only option VSD's IPv6-only subnets don't share with anything else in the
+// zone), falling back to the IPv6 address for a v6-only lookup.
+func (nvsdc *NuageVsdClient) GetSubnetID(zoneID string, subnets ...IPSubnet) (string, error) {
+	var v4, v6 IPSubnet
+	for _, s := range subnets {
+		if s.vsdIPType() == "IPV6" {
+			v6 = s
+		} else {
+			v4 = s
+		}
+	}
 	result := make([]api.VsdSubnet, 1)
 	h := nvsdc.session.Header
-	h.Add("X-Nuage-Filter", `address == "`+subnet.Address.String()+`"`)
+	var wantAddress string
+	if v4 != nil {
+		wantAddress = v4.addressString()
+		h.Add("X-Nuage-Filter", `address == "`+wantAddress+`"`)
+	} else if v6 != nil {
+		wantAddress = v6.addressString()
+		h.Add("X-Nuage-Filter", `IPv6Address == "`+wantAddress+`"`)
+	} else {
+		return "", errors.New("GetSubnetID needs at least one IPv4Subnet or IPv6Subnet")
+	}
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Get(nvsdc.url+"zones/"+zoneID+"/subnets", nil, &result, &e)
+	resp, err := instrumentVsdRequest("get_subnet_id", "subnet", func() (*napping.Response, error) {
+		return nvsdc.session.Get(nvsdc.url+"zones/"+zoneID+"/subnets", nil, &result, &e)
+	})
 	h.Del("X-Nuage-Filter")
 	if err != nil {
 		glog.Errorf("Error when getting subnet ID %s", err)
 		return "", err
 	}
 	glog.Infoln("Got a reponse status", resp.Status(), "when getting subnet ID")
-	if resp.Status() == 200 && result[0].Address == subnet.Address.String() {
+	gotAddress := result[0].Address
+	if v4 == nil {
+		gotAddress = result[0].IPv6Address
+	}
+	if resp.Status() == 200 && gotAddress == wantAddress {
 		return result[0].ID, nil
 	} else {
 		return "", VsdErrorResponse(resp, &e)
@@ -938,6 +1217,16 @@ func (nvsdc *NuageVsdClient) GetDomainID(enterpriseID, name string) (string, err
 	}
 }
 
+// UpdatePodCache and RemovePodCache satisfy VsdAPI by forwarding to
+// nvsdc.namedPorts; see NamedPortCache.Update and NamedPortCache.Remove.
+func (nvsdc *NuageVsdClient) UpdatePodCache(namespace, podName string, labels map[string]string, containerPorts []corev1.ContainerPort) {
+	nvsdc.namedPorts.Update(namespace, podName, labels, containerPorts)
+}
+
+func (nvsdc *NuageVsdClient) RemovePodCache(namespace, podName string) {
+	nvsdc.namedPorts.Remove(namespace, podName)
+}
+
 func (nvsdc *NuageVsdClient) Run(nsChannel chan *api.NamespaceEvent, serviceChannel chan *api.ServiceEvent, stop chan bool) {
 	//we will use the kube client APIs than interfacing with the REST API
 	for {
@@ -951,7 +1240,11 @@ func (nvsdc *NuageVsdClient) Run(nsChannel chan *api.NamespaceEvent, serviceChan
 	}
 }
 
+// HandleServiceEvent takes nvsdc.mu for the duration of the call; see
+// HandleNsEvent's doc comment for why.
 func (nvsdc *NuageVsdClient) HandleServiceEvent(serviceEvent *api.ServiceEvent) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
 	glog.Infoln("Received a service event: Service: ", serviceEvent)
 	switch serviceEvent.Type {
 	case api.Added:
@@ -992,12 +1285,18 @@ func (nvsdc *NuageVsdClient) HandleServiceEvent(serviceEvent *api.ServiceEvent)
 		networkMacroID, err := nvsdc.CreateNetworkMacro(nvsdc.enterpriseID, networkMacro)
 		if err != nil {
 			glog.Error("Error when creating the network macro for service", serviceEvent)
+			nvsdc.recordServiceFailure(serviceEvent.Namespace, serviceEvent.Name, "VsdNetworkMacroCreateFailed", "Failed to create VSD network macro: %s", err)
 		} else {
 			//add the network macro to the cached datastructure and also to the network macro group obtained via annotations/default group
 			nvsdc.namespaces[serviceEvent.Namespace].NetworkMacros[serviceEvent.Name] = networkMacroID
+			if err := nvsdc.store.put(vsdStoreKey{nvsdc.enterpriseID, vsdResourceNetworkMacro, networkMacro.Name}, networkMacroID, serviceEvent.Namespace); err != nil {
+				glog.Warningf("Failed to persist network macro %s to the VSD store: %s", networkMacro.Name, err)
+			}
 			nmgPayload := []string{networkMacroID}
 			e := api.RESTError{}
-			resp, err := nvsdc.session.Put(nvsdc.url+"networkmacrogroups/"+nmgID+"/enterprisenetworks", &nmgPayload, nil, &e)
+			resp, err := instrumentVsdRequest("add_macro_to_group", "network_macro_group", func() (*napping.Response, error) {
+				return nvsdc.session.Put(nvsdc.url+"networkmacrogroups/"+nmgID+"/enterprisenetworks", &nmgPayload, nil, &e)
+			})
 			if err != nil {
 				glog.Error("Error when adding network macro to the network macro group", err)
 				return err
@@ -1013,16 +1312,36 @@ func (nvsdc *NuageVsdClient) HandleServiceEvent(serviceEvent *api.ServiceEvent)
 				}
 			}
 		}
+		nvsdc.services[serviceKey(serviceEvent.Namespace, serviceEvent.Name)] = serviceInfo{
+			namespace: serviceEvent.Namespace,
+			selector:  serviceEvent.Selector,
+			clusterIP: serviceEvent.ClusterIP,
+			nodePort:  serviceEvent.NodePort,
+		}
+		nvsdc.reconcileNamespaceServiceAcls(serviceEvent.Namespace)
 	case api.Deleted:
 		zone := serviceEvent.Namespace
 		if _, exists := nvsdc.namespaces[zone]; exists {
 			if nmID, exists := nvsdc.namespaces[zone].NetworkMacros[serviceEvent.Name]; exists {
-				err := nvsdc.DeleteNetworkMacro(nmID)
+				// The macro was added to the zone's own network macro group
+				// unless a per-Service annotation pointed it at a different
+				// one; that annotated group ID isn't remembered, so a stuck
+				// delete for such a macro can only be reconciled against its
+				// zone's group, same as the nmgID default above.
+				nmgID := nvsdc.namespaces[zone].NetworkMacroGroupID
+				err := deleteWithReconcile(
+					func() error { return nvsdc.DeleteNetworkMacro(nmID) },
+					func() error { return nvsdc.removeMacroFromGroup(nmID, nmgID) },
+				)
 				if err != nil {
 					glog.Error("Error when deleting network macro with ID: ", nmID)
 					return err
 				} else {
 					delete(nvsdc.namespaces[zone].NetworkMacros, nmID)
+					macroName := `NetworkMacro for service: ` + serviceEvent.Namespace + "/" + serviceEvent.Name
+					if err := nvsdc.store.delete(vsdStoreKey{nvsdc.enterpriseID, vsdResourceNetworkMacro, macroName}); err != nil {
+						glog.Warningf("Failed to remove network macro %s from the VSD store: %s", macroName, err)
+					}
 				}
 			} else {
 				glog.Warning("Could not retrieve network macro ID for the service that is being deleted", serviceEvent)
@@ -1030,42 +1349,86 @@ func (nvsdc *NuageVsdClient) HandleServiceEvent(serviceEvent *api.ServiceEvent)
 		} else {
 			glog.Warning("Could not retrieve namespace for the service that is being deleted", serviceEvent)
 		}
+		delete(nvsdc.services, serviceKey(serviceEvent.Namespace, serviceEvent.Name))
+		nvsdc.reconcileNamespaceServiceAcls(serviceEvent.Namespace)
 	}
 	return nil
 }
 
+// HandleNsEvent takes nvsdc.mu for the duration of the call so it can't
+// interleave with the service/networkpolicy workers or reconcileDrift, all
+// of which share nvsdc.namespaces/zones/subnets and the session's
+// X-Nuage-Filter header with no other synchronization of their own.
 func (nvsdc *NuageVsdClient) HandleNsEvent(nsEvent *api.NamespaceEvent) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	return nvsdc.handleNsEvent(nsEvent)
+}
+
+// handleNsEvent is HandleNsEvent's body, unexported so ReconcileZones - which
+// already holds nvsdc.mu by the time it needs to create or delete a zone -
+// can call it directly instead of re-locking.
+func (nvsdc *NuageVsdClient) handleNsEvent(nsEvent *api.NamespaceEvent) error {
 	glog.Infoln("Received a namespace event: Namespace: ", nsEvent.Name, nsEvent.Type)
 	switch nsEvent.Type {
 	case api.Added:
 		if _, exists := nvsdc.namespaces[nsEvent.Name]; !exists {
 			zoneID, err := nvsdc.CreateZone(nvsdc.domainID, nsEvent.Name)
 			if err != nil {
+				nvsdc.recordNamespaceFailure(nsEvent.Name, "VsdZoneCreateFailed", "Failed to create VSD zone: %s", err)
 				return err
 			}
 			nvsdc.zones[nsEvent.Name] = zoneID
+			if err := nvsdc.store.put(vsdStoreKey{nvsdc.enterpriseID, vsdResourceZone, nsEvent.Name}, zoneID, nsEvent.Name); err != nil {
+				glog.Warningf("Failed to persist zone %s to the VSD store: %s", nsEvent.Name, err)
+			}
 			// subnetSize is guaranteed to be between 0 and 32 (inclusive) by
 			// the Init() function defined above, so (32 - subnetSize) will
 			// also produce a number between 0 and 32 (inclusive).
-			subnet, err := nvsdc.pool.Alloc(32 - nvsdc.subnetSize)
-			if err != nil {
-				return err
+			var ipSubnets []IPSubnet
+			var subnet *IPv4Subnet
+			if nvsdc.ipv4Enabled {
+				subnet, err = nvsdc.pool.Alloc(32 - nvsdc.subnetSize)
+				if err != nil {
+					vsdPoolExhaustion.WithLabelValues("ipv4").Inc()
+					nvsdc.recordNamespaceFailure(nsEvent.Name, "VsdSubnetPoolExhausted", "No IPv4 subnet available to allocate: %s", err)
+					return err
+				}
+				ipSubnets = append(ipSubnets, subnet)
 			}
-			subnetID, err := nvsdc.CreateSubnet(nsEvent.Name+"-0", zoneID, subnet)
+			var subnetV6 *IPv6Subnet
+			if nvsdc.ipv6Enabled {
+				subnetV6, err = nvsdc.poolV6.Alloc(128 - nvsdc.subnetSizeV6)
+				if err != nil {
+					vsdPoolExhaustion.WithLabelValues("ipv6").Inc()
+					if subnet != nil {
+						nvsdc.pool.Free(subnet)
+					}
+					nvsdc.recordNamespaceFailure(nsEvent.Name, "VsdSubnetPoolExhausted", "No IPv6 subnet available to allocate: %s", err)
+					return err
+				}
+				ipSubnets = append(ipSubnets, subnetV6)
+			}
+			subnetID, err := nvsdc.CreateSubnet(nsEvent.Name+"-0", zoneID, ipSubnets...)
 			if err != nil {
-				nvsdc.pool.Free(subnet)
+				if subnet != nil {
+					nvsdc.pool.Free(subnet)
+				}
+				if subnetV6 != nil {
+					nvsdc.poolV6.Free(subnetV6)
+				}
+				nvsdc.recordNamespaceFailure(nsEvent.Name, "VsdSubnetCreateFailed", "Failed to create VSD subnet: %s", err)
 				return err
-			} else {
-				nvsdc.subnets[zoneID] = &SubnetList{SubnetID: subnetID, Subnet: subnet, Next: nil}
 			}
+			nvsdc.subnets[zoneID] = &SubnetList{SubnetID: subnetID, Subnet: subnet, SubnetV6: subnetV6, Next: nil}
 			if nsEvent.Name == "default" {
-				err = nvsdc.CreateDefaultZoneAcls(zoneID)
+				err = nvsdc.CreateDefaultZoneAcls(zoneID, nsEvent.UID)
 				if err != nil {
 					glog.Error("Got an error when creating default zone's ACL entries")
 					return err
 				}
 			} else {
-				err = nvsdc.CreateSpecificZoneAcls(nsEvent.Name, zoneID)
+				err = nvsdc.CreateSpecificZoneAcls(nsEvent.Name, zoneID, nsEvent.UID)
 				if err != nil {
 					glog.Error("Got an error when creating zone specific ACLs", nsEvent.Name)
 					return err
@@ -1083,23 +1446,45 @@ func (nvsdc *NuageVsdClient) HandleNsEvent(nsEvent *api.NamespaceEvent) error {
 			return err
 		case id != "" && err == nil:
 			if nsEvent.Name == "default" {
-				err = nvsdc.CreateDefaultZoneAcls(id)
+				err = nvsdc.CreateDefaultZoneAcls(id, nsEvent.UID)
 				if err != nil {
 					glog.Error("Got an error when creating default zone's ACL entries")
 					return err
 				}
 			} else {
-				err = nvsdc.CreateSpecificZoneAcls(nsEvent.Name, id)
+				err = nvsdc.CreateSpecificZoneAcls(nsEvent.Name, id, nsEvent.UID)
 				if err != nil {
 					glog.Error("Got an error when creating zone specific ACLs", nsEvent.Name)
 					return err
 				}
 			}
-			nvsdc.namespaces[nsEvent.Name] = NamespaceData{ZoneID: id, NetworkMacros: make(map[string]string)}
+			if nsd, exists := nvsdc.namespaces[nsEvent.Name]; exists {
+				// CreateDefaultZoneAcls/CreateSpecificZoneAcls already
+				// populated this entry (NetworkMacroGroupID, UID); just
+				// record the zone ID without clobbering it.
+				nsd.ZoneID = id
+				nvsdc.namespaces[nsEvent.Name] = nsd
+			} else {
+				nvsdc.namespaces[nsEvent.Name] = NamespaceData{ZoneID: id, UID: nsEvent.UID, NetworkMacros: make(map[string]string)}
+			}
+			if err := nvsdc.store.put(vsdStoreKey{nvsdc.enterpriseID, vsdResourceZone, nsEvent.Name}, id, nsEvent.Name); err != nil {
+				glog.Warningf("Failed to persist zone %s to the VSD store: %s", nsEvent.Name, err)
+			}
 			return nil
 		}
 	case api.Deleted:
 		if zone, exists := nvsdc.namespaces[nsEvent.Name]; exists {
+			// A namespace deleted and immediately recreated with the same
+			// name can leave a stale Deleted event in flight behind the new
+			// namespace's own Added event; by the time it's processed here,
+			// nvsdc.namespaces[nsEvent.Name] already holds the new
+			// namespace's zone/network macro group. Comparing UIDs catches
+			// that race and drops the stale event instead of tearing down
+			// the namespace that's actually running.
+			if nsEvent.UID != "" && zone.UID != "" && zone.UID != nsEvent.UID {
+				glog.Warningf("Ignoring delete for namespace %s: cached zone belongs to a different namespace generation (UID %s, event UID %s)", nsEvent.Name, zone.UID, nsEvent.UID)
+				return nil
+			}
 			// Delete subnets that we've created, and free them back into the pool
 			if nsEvent.Name == "default" {
 				err := nvsdc.DeleteDefaultZoneAcls(zone.ZoneID)
@@ -1122,10 +1507,19 @@ func (nvsdc *NuageVsdClient) HandleNsEvent(nsEvent *api.NamespaceEvent) error {
 						glog.Warningf("Failed to delete subnet %q in zone %q",
 							subnet.SubnetID, nsEvent.Name)
 					}
-					err = nvsdc.pool.Free(subnet.Subnet)
-					if err != nil {
-						glog.Warningf("Failed to free subnet %q from zone %q",
-							subnet.Subnet.String(), nsEvent.Name)
+					if subnet.Subnet != nil {
+						err = nvsdc.pool.Free(subnet.Subnet)
+						if err != nil {
+							glog.Warningf("Failed to free subnet %q from zone %q",
+								subnet.Subnet.String(), nsEvent.Name)
+						}
+					}
+					if subnet.SubnetV6 != nil {
+						err = nvsdc.poolV6.Free(subnet.SubnetV6)
+						if err != nil {
+							glog.Warningf("Failed to free IPv6 subnet %q from zone %q",
+								subnet.SubnetV6.String(), nsEvent.Name)
+						}
 					}
 					subnet = subnet.Next
 				}
@@ -1134,7 +1528,13 @@ func (nvsdc *NuageVsdClient) HandleNsEvent(nsEvent *api.NamespaceEvent) error {
 				delete(nvsdc.subnets, zone.ZoneID)
 			}
 			delete(nvsdc.namespaces, nsEvent.Name)
-			return nvsdc.DeleteZone(zone.ZoneID)
+			if err := nvsdc.store.delete(vsdStoreKey{nvsdc.enterpriseID, vsdResourceZone, nsEvent.Name}); err != nil {
+				glog.Warningf("Failed to remove zone %s from the VSD store: %s", nsEvent.Name, err)
+			}
+			if err := nvsdc.DeleteZone(zone.ZoneID); err != nil && !IsNotFound(err) {
+				return err
+			}
+			return nil
 		}
 		id, err := nvsdc.GetZoneID(nvsdc.domainID, nsEvent.Name)
 		switch {
@@ -1146,6 +1546,9 @@ func (nvsdc *NuageVsdClient) HandleNsEvent(nsEvent *api.NamespaceEvent) error {
 			return err
 		case id != "" && err == nil:
 			glog.Infof("Deleting zone %s which was not found locally", nsEvent.Name)
+			if err := nvsdc.store.delete(vsdStoreKey{nvsdc.enterpriseID, vsdResourceZone, nsEvent.Name}); err != nil {
+				glog.Warningf("Failed to remove zone %s from the VSD store: %s", nsEvent.Name, err)
+			}
 			if nsEvent.Name == "default" {
 				err = nvsdc.DeleteDefaultZoneAcls(id)
 				if err != nil {
@@ -1159,13 +1562,115 @@ func (nvsdc *NuageVsdClient) HandleNsEvent(nsEvent *api.NamespaceEvent) error {
 					return err
 				}
 			}
-			return nvsdc.DeleteZone(id)
+			if err := nvsdc.DeleteZone(id); err != nil && !IsNotFound(err) {
+				return err
+			}
+			return nil
 		}
 	}
 	return nil
 }
 
-func (nvsdc *NuageVsdClient) CreateDefaultZoneAcls(zoneID string) error {
+// ReconcileZones diffs the zones actually present in VSD against
+// currentNamespaces - the namespace names a Controller resync pass reads
+// from its informer's indexer - and repairs drift between the two: a
+// namespace missing its zone gets one created, the same way an Added event
+// would.  A zone with no matching namespace is left alone the first time
+// it's seen, since the informer cache or this call could just be running
+// ahead of a namespace's own Delete event; only once it's stayed orphaned
+// for longer than orphanGracePeriod does ReconcileZones delete it, the same
+// way a Deleted event for an untracked zone already does.  Both paths go
+// through handleNsEvent so the create/delete logic - subnets, ACLs, the
+// namespaces/zones/subnets maps - only lives in one place.  It takes
+// nvsdc.mu itself, the same as HandleNsEvent, since reconcileDrift runs on
+// its own goroutine alongside the namespace/service/networkpolicy workers.
+func (nvsdc *NuageVsdClient) ReconcileZones(currentNamespaces []string) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	zoneNames, err := nvsdc.ListZoneNames(nvsdc.domainID)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(currentNamespaces))
+	for _, name := range currentNamespaces {
+		wanted[name] = true
+	}
+	for name := range wanted {
+		if _, exists := nvsdc.namespaces[name]; exists {
+			continue
+		}
+		glog.Warningf("Resync: namespace %s has no zone, creating one", name)
+		if err := nvsdc.handleNsEvent(&api.NamespaceEvent{Type: api.Added, Name: name}); err != nil {
+			glog.Errorf("Resync: error creating zone for namespace %s: %s", name, err)
+		}
+	}
+	now := time.Now()
+	for _, zoneName := range zoneNames {
+		if wanted[zoneName] {
+			delete(nvsdc.orphanZones, zoneName)
+			continue
+		}
+		firstSeen, tracked := nvsdc.orphanZones[zoneName]
+		if !tracked {
+			nvsdc.orphanZones[zoneName] = now
+			glog.Warningf("Resync: zone %s has no matching namespace, deleting after %s if it's still orphaned", zoneName, nvsdc.orphanGracePeriod)
+			continue
+		}
+		if now.Sub(firstSeen) < nvsdc.orphanGracePeriod {
+			continue
+		}
+		glog.Warningf("Resync: deleting zone %s, orphaned for over %s", zoneName, nvsdc.orphanGracePeriod)
+		if err := nvsdc.handleNsEvent(&api.NamespaceEvent{Type: api.Deleted, Name: zoneName}); err != nil {
+			glog.Errorf("Resync: error deleting orphan zone %s: %s", zoneName, err)
+			continue
+		}
+		delete(nvsdc.orphanZones, zoneName)
+	}
+	return nil
+}
+
+// ReconcileStore replays the VSD store built up by every zone/network-macro/
+// network-macro-group Create and Delete, and deletes from VSD any record
+// whose owning namespace isn't in currentNamespaces - the case ReconcileZones
+// itself can't catch, since a crash between a VSD Create succeeding and its
+// ID landing in nvsdc.namespaces/nvsdc.zones means that object was never in
+// the in-memory maps to begin with. It's meant to run once, at Controller
+// startup, before the namespace informer's own initial sync has a chance to
+// re-derive the in-memory state from scratch.
+func (nvsdc *NuageVsdClient) ReconcileStore(currentNamespaces []string) error {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	wanted := make(map[string]bool, len(currentNamespaces))
+	for _, name := range currentNamespaces {
+		wanted[name] = true
+	}
+	for _, record := range nvsdc.store.all() {
+		if wanted[record.Namespace] {
+			continue
+		}
+		glog.Warningf("Resync: %s %q belongs to namespace %s which no longer exists, deleting it from VSD",
+			record.Key.ResourceType, record.Key.Name, record.Namespace)
+		var err error
+		switch record.Key.ResourceType {
+		case vsdResourceZone:
+			err = nvsdc.DeleteZone(record.VsdID)
+		case vsdResourceNetworkMacroGroup:
+			err = nvsdc.DeleteNetworkMacroGroup(record.VsdID)
+		case vsdResourceNetworkMacro:
+			err = nvsdc.DeleteNetworkMacro(record.VsdID)
+		}
+		if err != nil {
+			glog.Errorf("Resync: error deleting orphaned %s %q: %s", record.Key.ResourceType, record.Key.Name, err)
+			continue
+		}
+		if err := nvsdc.store.delete(record.Key); err != nil {
+			glog.Warningf("Failed to remove %s %q from the VSD store: %s", record.Key.ResourceType, record.Key.Name, err)
+		}
+	}
+	return nil
+}
+
+func (nvsdc *NuageVsdClient) CreateDefaultZoneAcls(zoneID string, uid string) error {
 	nmgid, err := nvsdc.CreateNetworkMacroGroup(nvsdc.enterpriseID, "default")
 	if err != nil {
 		glog.Error("Error when creating the network macro group for zone", "default")
@@ -1173,39 +1678,48 @@ func (nvsdc *NuageVsdClient) CreateDefaultZoneAcls(zoneID string) error {
 	} else {
 		if nsd, exists := nvsdc.namespaces["default"]; exists {
 			nsd.NetworkMacroGroupID = nmgid
+			nsd.UID = uid
+			nvsdc.namespaces["default"] = nsd
 		} else {
-			nvsdc.namespaces["default"] = NamespaceData{ZoneID: zoneID, NetworkMacroGroupID: nmgid, NetworkMacros: make(map[string]string)}
+			nvsdc.namespaces["default"] = NamespaceData{ZoneID: zoneID, NetworkMacroGroupID: nmgid, UID: uid, NetworkMacros: make(map[string]string)}
+		}
+		if err := nvsdc.store.put(vsdStoreKey{nvsdc.enterpriseID, vsdResourceNetworkMacroGroup, "default"}, nmgid, "default"); err != nil {
+			glog.Warningf("Failed to persist network macro group for the default zone to the VSD store: %s", err)
 		}
 	}
 	//add ingress and egress ACL entries for allowing zone to default zone communication
-	aclEntry := api.VsdAclEntry{
-		Action:       "FORWARD",
-		Description:  "Allow Traffic Between All Zones and Default Zone",
-		EntityScope:  "ENTERPRISE",
-		EtherType:    "0x800",
-		LocationID:   "",
-		LocationType: "ANY",
-		NetworkType:  "NETWORK_MACRO_GROUP",
-		NetworkID:    nmgid,
-		PolicyState:  "LIVE",
-		Priority:     1,
-		Protocol:     "ANY",
-		Reflexive:    false,
-	}
-	_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating the ACL rules for the default zone")
-		return err
-	}
-	_, err = nvsdc.CreateAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating the ACL rules for the default zone")
-		return err
+	for i, etherType := range nvsdc.etherTypes() {
+		aclEntry := api.VsdAclEntry{
+			Action:       "FORWARD",
+			Description:  "Allow Traffic Between All Zones and Default Zone" + etherTypeSuffix(etherType),
+			EntityScope:  "ENTERPRISE",
+			EtherType:    etherType,
+			LocationID:   "",
+			LocationType: "ANY",
+			NetworkType:  "NETWORK_MACRO_GROUP",
+			NetworkID:    nmgid,
+			PolicyState:  "LIVE",
+			// Past the intra-zone allow entries (priorities 0 to one less
+			// than the number of address families).
+			Priority:     len(nvsdc.etherTypes()) + i,
+			Protocol:     "ANY",
+			Reflexive:    false,
+		}
+		_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating the ACL rules for the default zone")
+			return err
+		}
+		_, err = nvsdc.CreateAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating the ACL rules for the default zone")
+			return err
+		}
 	}
 	return nil
 }
 
-func (nvsdc *NuageVsdClient) CreateSpecificZoneAcls(zoneName string, zoneID string) error {
+func (nvsdc *NuageVsdClient) CreateSpecificZoneAcls(zoneName string, zoneID string, uid string) error {
 	//first create the network macro group for the zone.
 	nmgid, err := nvsdc.CreateNetworkMacroGroup(nvsdc.enterpriseID, zoneName)
 	if err != nil {
@@ -1214,44 +1728,61 @@ func (nvsdc *NuageVsdClient) CreateSpecificZoneAcls(zoneName string, zoneID stri
 	} else {
 		if nsd, exists := nvsdc.namespaces[zoneName]; exists {
 			nsd.NetworkMacroGroupID = nmgid
+			nsd.UID = uid
+			nvsdc.namespaces[zoneName] = nsd
 		} else {
-			nvsdc.namespaces[zoneName] = NamespaceData{ZoneID: zoneID, NetworkMacroGroupID: nmgid, NetworkMacros: make(map[string]string)}
+			nvsdc.namespaces[zoneName] = NamespaceData{ZoneID: zoneID, NetworkMacroGroupID: nmgid, UID: uid, NetworkMacros: make(map[string]string)}
+		}
+		if err := nvsdc.store.put(vsdStoreKey{nvsdc.enterpriseID, vsdResourceNetworkMacroGroup, zoneName}, nmgid, zoneName); err != nil {
+			glog.Warningf("Failed to persist network macro group for zone %s to the VSD store: %s", zoneName, err)
 		}
 	}
 	//add ingress and egress ACL entries for allowing zone to default zone communication
-	aclEntry := api.VsdAclEntry{
-		Action:       "FORWARD",
-		Description:  "Allow Traffic Between Zone - " + zoneName + " And Its Services",
-		EntityScope:  "ENTERPRISE",
-		EtherType:    "0x800",
-		LocationID:   nvsdc.namespaces[zoneName].ZoneID,
-		LocationType: "ZONE",
-		NetworkID:    nmgid,
-		NetworkType:  "NETWORK_MACRO_GROUP",
-		PolicyState:  "LIVE",
-		Priority:     300 + nvsdc.NextAvailablePriority(),
-		Protocol:     "ANY",
-		Reflexive:    false,
-	}
-	_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating the ACL rules for the default zone")
-		return err
-	} else {
-		nvsdc.SetNextAvailablePriority(aclEntry.Priority + 1)
-	}
-	_, err = nvsdc.CreateAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry)
-	if err != nil {
-		glog.Error("Error when creating the ACL rules for the default zone")
-		return err
-	} else {
-		nvsdc.SetNextAvailablePriority(aclEntry.Priority + 1)
+	for _, etherType := range nvsdc.etherTypes() {
+		aclEntry := api.VsdAclEntry{
+			Action:       "FORWARD",
+			Description:  "Allow Traffic Between Zone - " + zoneName + " And Its Services" + etherTypeSuffix(etherType),
+			EntityScope:  "ENTERPRISE",
+			EtherType:    etherType,
+			LocationID:   nvsdc.namespaces[zoneName].ZoneID,
+			LocationType: "ZONE",
+			NetworkID:    nmgid,
+			NetworkType:  "NETWORK_MACRO_GROUP",
+			PolicyState:  "LIVE",
+			Priority:     300 + nvsdc.NextAvailablePriority(),
+			Protocol:     "ANY",
+			Reflexive:    false,
+		}
+		_, err = nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating the ACL rules for the default zone")
+			return err
+		} else {
+			nvsdc.SetNextAvailablePriority(aclEntry.Priority + 1)
+		}
+		_, err = nvsdc.CreateAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry)
+		if err != nil {
+			glog.Error("Error when creating the ACL rules for the default zone")
+			return err
+		} else {
+			nvsdc.SetNextAvailablePriority(aclEntry.Priority + 1)
+		}
 	}
 	return nil
 }
 
+// aclPriorityCeiling bounds how far NextAvailablePriority can push
+// networkPolicyPriorityFloor before it would collide with the
+// intra-domain drop entries CreateIngressAclEntries/CreateEgressAclEntries
+// install at priority 1000000000.
+const aclPriorityCeiling = 1000000000 - networkPolicyPriorityFloor
+
 func (nvsdc *NuageVsdClient) NextAvailablePriority() int {
 	defer nvsdc.IncrementNextAvailablePriority()
+	if nvsdc.nextAvailablePriority >= aclPriorityCeiling {
+		vsdAclPriorityOverflow.Inc()
+		glog.Errorf("NextAvailablePriority %d has reached the ACL priority ceiling of %d", nvsdc.nextAvailablePriority, aclPriorityCeiling)
+	}
 	return nvsdc.nextAvailablePriority
 }
 
@@ -1264,13 +1795,22 @@ func (nvsdc *NuageVsdClient) SetNextAvailablePriority(val int) {
 }
 
 func (nvsdc *NuageVsdClient) CreateNetworkMacroGroup(enterpriseID string, zoneName string) (string, error) {
+	return nvsdc.CreateNetworkMacroGroupCtx(nvsdc.ctx, enterpriseID, zoneName)
+}
+
+// CreateNetworkMacroGroupCtx is CreateNetworkMacroGroup with an explicit
+// context; cancelling ctx aborts the in-flight HTTP request itself (see
+// ctxTransport) instead of just unblocking the caller while it keeps running.
+func (nvsdc *NuageVsdClient) CreateNetworkMacroGroupCtx(ctx context.Context, enterpriseID string, zoneName string) (string, error) {
 	result := make([]api.VsdObject, 1)
 	payload := api.VsdObject{
 		Name:        "Service Group For Zone - " + zoneName,
 		Description: "Auto-generated network macro group for zone - " + zoneName,
 	}
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Post(nvsdc.url+"enterprises/"+enterpriseID+"/networkmacrogroups", &payload, &result, &e)
+	resp, err := nvsdc.ctxVsdRequest(ctx, "create_network_macro_group", "network_macro_group", func() (*napping.Response, error) {
+		return nvsdc.session.Post(nvsdc.url+"enterprises/"+enterpriseID+"/networkmacrogroups", &payload, &result, &e)
+	})
 	if err != nil {
 		glog.Error("Error when creating network macro group for zone: ", zoneName, err)
 		return "", err
@@ -1283,7 +1823,7 @@ func (nvsdc *NuageVsdClient) CreateNetworkMacroGroup(enterpriseID string, zoneNa
 	case 409:
 		//Network Macro Group already exists, call Get to retrieve the ID
 		nmgName := "Service Group For Zone - " + zoneName
-		id, err := nvsdc.GetNetworkMacroGroupID(enterpriseID, nmgName)
+		id, err := nvsdc.GetNetworkMacroGroupIDCtx(ctx, enterpriseID, nmgName)
 		if err != nil {
 			glog.Errorf("Error when getting network macro group ID for zone: %s - %s", zoneName, err)
 			return "", err
@@ -1295,11 +1835,20 @@ func (nvsdc *NuageVsdClient) CreateNetworkMacroGroup(enterpriseID string, zoneNa
 }
 
 func (nvsdc *NuageVsdClient) GetNetworkMacroGroupID(enterpriseID, nmgName string) (string, error) {
+	return nvsdc.GetNetworkMacroGroupIDCtx(nvsdc.ctx, enterpriseID, nmgName)
+}
+
+// GetNetworkMacroGroupIDCtx is GetNetworkMacroGroupID with an explicit
+// context; cancelling ctx aborts the in-flight HTTP request itself (see
+// ctxTransport) instead of just unblocking the caller while it keeps running.
+func (nvsdc *NuageVsdClient) GetNetworkMacroGroupIDCtx(ctx context.Context, enterpriseID, nmgName string) (string, error) {
 	result := make([]api.VsdObject, 1)
 	h := nvsdc.session.Header
 	h.Add("X-Nuage-Filter", `name == "`+nmgName+`"`)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Get(nvsdc.url+"enterprises/"+enterpriseID+"/networkmacrogroups", nil, &result, &e)
+	resp, err := nvsdc.ctxVsdRequest(ctx, "get_network_macro_group_id", "network_macro_group", func() (*napping.Response, error) {
+		return nvsdc.session.Get(nvsdc.url+"enterprises/"+enterpriseID+"/networkmacrogroups", nil, &result, &e)
+	})
 	h.Del("X-Nuage-Filter")
 	if err != nil {
 		glog.Errorf("Error when getting network macro group ID with name: %s - %s", nmgName, err)
@@ -1324,11 +1873,20 @@ func (nvsdc *NuageVsdClient) GetNetworkMacroGroupID(enterpriseID, nmgName string
 }
 
 func (nvsdc *NuageVsdClient) DeleteNetworkMacroGroup(networkMacroGroupID string) error {
+	return nvsdc.DeleteNetworkMacroGroupCtx(nvsdc.ctx, networkMacroGroupID)
+}
+
+// DeleteNetworkMacroGroupCtx is DeleteNetworkMacroGroup with an explicit
+// context; cancelling ctx aborts the in-flight HTTP request itself (see
+// ctxTransport) instead of just unblocking the caller while it keeps running.
+func (nvsdc *NuageVsdClient) DeleteNetworkMacroGroupCtx(ctx context.Context, networkMacroGroupID string) error {
 	// Delete network macro group
 	result := make([]struct{}, 1)
 	e := api.RESTError{}
 	url := nvsdc.url + "networkmacrogroups/" + networkMacroGroupID + "?responseChoice=1"
-	resp, err := nvsdc.session.Delete(url, &result, &e)
+	resp, err := nvsdc.ctxVsdRequest(ctx, "delete_network_macro_group", "network_macro_group", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(url, &result, &e)
+	})
 	if err != nil {
 		glog.Errorf("Error when deleting network macro group with ID %s: %s", networkMacroGroupID, err)
 		return err
@@ -1343,106 +1901,145 @@ func (nvsdc *NuageVsdClient) DeleteNetworkMacroGroup(networkMacroGroupID string)
 }
 
 func (nvsdc *NuageVsdClient) DeleteSpecificZoneAcls(zoneName string) error {
-	//add ingress and egress ACL entries for allowing zone to default zone communication
-	aclEntry := api.VsdAclEntry{
-		Action:       "FORWARD",
-		Description:  "Allow Traffic Between Zone - " + zoneName + " And Its Services",
-		EntityScope:  "ENTERPRISE",
-		EtherType:    "0x800",
-		LocationID:   nvsdc.namespaces[zoneName].ZoneID,
-		LocationType: "ZONE",
-		NetworkID:    nvsdc.namespaces[zoneName].NetworkMacroGroupID,
-		NetworkType:  "NETWORK_MACRO_GROUP",
-		PolicyState:  "LIVE",
-		Protocol:     "ANY",
-		Reflexive:    false,
-	}
-	if acl, err := nvsdc.GetAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry); err == nil && acl != nil {
-		err = nvsdc.DeleteAclEntry(true, acl.ID)
-		if err != nil {
-			glog.Error("Error when deleting the ingress ACL rules for the zone: ", zoneName, aclEntry)
-			return err
+	// deleteZoneServiceAcls removes the ingress/egress ACL entries that allow
+	// zoneName to reach its services' network macro group; it's also what
+	// deleteWithReconcile below reruns if the group delete comes back
+	// in-use, since that means one of these entries is still pointing at it.
+	deleteZoneServiceAcls := func() error {
+		for _, etherType := range nvsdc.etherTypes() {
+			aclEntry := api.VsdAclEntry{
+				Action:       "FORWARD",
+				Description:  "Allow Traffic Between Zone - " + zoneName + " And Its Services" + etherTypeSuffix(etherType),
+				EntityScope:  "ENTERPRISE",
+				EtherType:    etherType,
+				LocationID:   nvsdc.namespaces[zoneName].ZoneID,
+				LocationType: "ZONE",
+				NetworkID:    nvsdc.namespaces[zoneName].NetworkMacroGroupID,
+				NetworkType:  "NETWORK_MACRO_GROUP",
+				PolicyState:  "LIVE",
+				Protocol:     "ANY",
+				Reflexive:    false,
+			}
+			if acl, err := nvsdc.GetAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry); err != nil {
+				glog.Error("Failed to get ingress acl entry to delete", aclEntry)
+				return err
+			} else if acl != nil {
+				if err := nvsdc.DeleteAclEntry(true, acl.ID); err != nil && !IsNotFound(err) {
+					glog.Error("Error when deleting the ingress ACL rules for the zone: ", zoneName, aclEntry)
+					return err
+				}
+			}
+			if acl, err := nvsdc.GetAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry); err != nil {
+				glog.Error("Failed to get egress acl entry to delete", aclEntry)
+				return err
+			} else if acl != nil {
+				if err := nvsdc.DeleteAclEntry(false, acl.ID); err != nil && !IsNotFound(err) {
+					glog.Error("Error when deleting the egress ACL rules for the zone: ", zoneName, aclEntry)
+					return err
+				}
+			}
 		}
-	} else {
-		glog.Error("Failed to get ingress acl entry to delete", aclEntry)
-		return err
+		return nil
 	}
-	if acl, err := nvsdc.GetAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry); err == nil && acl != nil {
-		err = nvsdc.DeleteAclEntry(false, acl.ID)
-		if err != nil {
-			glog.Error("Error when deleting the egress ACL rules for the zone: ", zoneName, aclEntry)
-			return err
-		}
-	} else {
-		glog.Error("Failed to get egress acl entry to delete", aclEntry)
+	if err := deleteZoneServiceAcls(); err != nil {
 		return err
 	}
-	if nvsdc.namespaces[zoneName].NetworkMacroGroupID != "" {
-		err := nvsdc.DeleteNetworkMacroGroup(nvsdc.namespaces[zoneName].NetworkMacroGroupID)
+	if nsd := nvsdc.namespaces[zoneName]; nsd.NetworkMacroGroupID != "" {
+		err := deleteWithReconcile(
+			func() error { return nvsdc.DeleteNetworkMacroGroup(nsd.NetworkMacroGroupID) },
+			deleteZoneServiceAcls,
+		)
 		if err != nil {
 			glog.Error("Failed to delete network macro group for zone", zoneName)
 			return err
-		} else {
-			if nsd, exists := nvsdc.namespaces[zoneName]; exists {
-				nsd.NetworkMacroGroupID = ""
-			}
+		}
+		nsd.NetworkMacroGroupID = ""
+		nvsdc.namespaces[zoneName] = nsd
+		if err := nvsdc.store.delete(vsdStoreKey{nvsdc.enterpriseID, vsdResourceNetworkMacroGroup, zoneName}); err != nil {
+			glog.Warningf("Failed to remove network macro group for zone %s from the VSD store: %s", zoneName, err)
 		}
 	}
 	return nil
 }
 
 func (nvsdc *NuageVsdClient) DeleteDefaultZoneAcls(zoneID string) error {
-	aclEntry := api.VsdAclEntry{
-		Action:       "FORWARD",
-		Description:  "Allow Traffic Between All Zones and Default Zone",
-		EntityScope:  "ENTERPRISE",
-		EtherType:    "0x800",
-		LocationID:   "",
-		LocationType: "ANY",
-		NetworkID:    nvsdc.namespaces["default"].NetworkMacroGroupID,
-		NetworkType:  "NETWORK_MACRO_GROUP",
-		PolicyState:  "LIVE",
-		Protocol:     "ANY",
-		Reflexive:    false,
-	}
-	if acl, err := nvsdc.GetAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry); err == nil && acl != nil {
-		err = nvsdc.DeleteAclEntry(true, acl.ID)
-		if err != nil {
-			glog.Error("Error when deleting the ingress ACL rules for the default zone", aclEntry)
-			return err
+	// deleteDefaultZoneServiceAcls removes the ingress/egress ACL entries
+	// that allow every zone to reach the default zone's network macro group;
+	// it's also what deleteWithReconcile below reruns if the group delete
+	// comes back in-use, since that means one of these entries is still
+	// pointing at it.
+	deleteDefaultZoneServiceAcls := func() error {
+		for _, etherType := range nvsdc.etherTypes() {
+			aclEntry := api.VsdAclEntry{
+				Action:       "FORWARD",
+				Description:  "Allow Traffic Between All Zones and Default Zone" + etherTypeSuffix(etherType),
+				EntityScope:  "ENTERPRISE",
+				EtherType:    etherType,
+				LocationID:   "",
+				LocationType: "ANY",
+				NetworkID:    nvsdc.namespaces["default"].NetworkMacroGroupID,
+				NetworkType:  "NETWORK_MACRO_GROUP",
+				PolicyState:  "LIVE",
+				Protocol:     "ANY",
+				Reflexive:    false,
+			}
+			if acl, err := nvsdc.GetAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry); err != nil {
+				glog.Error("Failed to get ingress acl entry to delete", aclEntry)
+				return err
+			} else if acl != nil {
+				if err := nvsdc.DeleteAclEntry(true, acl.ID); err != nil && !IsNotFound(err) {
+					glog.Error("Error when deleting the ingress ACL rules for the default zone", aclEntry)
+					return err
+				}
+			}
+			if acl, err := nvsdc.GetAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry); err != nil {
+				glog.Error("Failed to get egress acl entry to delete", aclEntry)
+				return err
+			} else if acl != nil {
+				if err := nvsdc.DeleteAclEntry(false, acl.ID); err != nil && !IsNotFound(err) {
+					glog.Error("Error when deleting the egress ACL rules for the default zone", aclEntry)
+					return err
+				}
+			}
 		}
-	} else {
-		glog.Error("Failed to get ingress acl entry to delete", aclEntry)
-		return err
+		return nil
 	}
-	if acl, err := nvsdc.GetAclEntry(nvsdc.egressAclTemplateID, false, &aclEntry); err == nil && acl != nil {
-		err = nvsdc.DeleteAclEntry(false, acl.ID)
-		if err != nil {
-			glog.Error("Error when deleting the egress ACL rules for the default zone", aclEntry)
-			return err
-		}
-	} else {
-		glog.Error("Failed to get egress acl entry to delete", aclEntry)
+	if err := deleteDefaultZoneServiceAcls(); err != nil {
 		return err
 	}
-	if nvsdc.namespaces["default"].NetworkMacroGroupID != "" {
-		err := nvsdc.DeleteNetworkMacroGroup(nvsdc.namespaces["default"].NetworkMacroGroupID)
+	if nsd := nvsdc.namespaces["default"]; nsd.NetworkMacroGroupID != "" {
+		err := deleteWithReconcile(
+			func() error { return nvsdc.DeleteNetworkMacroGroup(nsd.NetworkMacroGroupID) },
+			deleteDefaultZoneServiceAcls,
+		)
 		if err != nil {
 			glog.Error("Failed to delete network macro group for default zone")
 			return err
-		} else {
-			if nsd, exists := nvsdc.namespaces["default"]; exists {
-				nsd.NetworkMacroGroupID = ""
-			}
+		}
+		nsd.NetworkMacroGroupID = ""
+		nvsdc.namespaces["default"] = nsd
+		if err := nvsdc.store.delete(vsdStoreKey{nvsdc.enterpriseID, vsdResourceNetworkMacroGroup, "default"}); err != nil {
+			glog.Warningf("Failed to remove network macro group for the default zone from the VSD store: %s", err)
 		}
 	}
 	return nil
 }
 
 func (nvsdc *NuageVsdClient) CreateNetworkMacro(enterpriseID string, networkMacro *api.VsdNetworkMacro) (string, error) {
+	return nvsdc.CreateNetworkMacroCtx(nvsdc.ctx, enterpriseID, networkMacro)
+}
+
+// CreateNetworkMacroCtx is CreateNetworkMacro with an explicit context;
+// cancelling ctx aborts the in-flight HTTP request itself (see ctxTransport)
+// instead of just unblocking the caller while it keeps running.
+func (nvsdc *NuageVsdClient) CreateNetworkMacroCtx(ctx context.Context, enterpriseID string, networkMacro *api.VsdNetworkMacro) (string, error) {
 	result := make([]api.VsdNetworkMacro, 1)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Post(nvsdc.url+"enterprises/"+enterpriseID+"/enterprisenetworks", networkMacro, &result, &e)
+	resp, err := nvsdc.ctxVsdRequest(ctx, "create_network_macro", "network_macro", func() (*napping.Response, error) {
+		return nvsdc.reqPool.do(func() (*napping.Response, error) {
+			return nvsdc.session.Post(nvsdc.url+"enterprises/"+enterpriseID+"/enterprisenetworks", networkMacro, &result, &e)
+		})
+	})
 	if err != nil {
 		glog.Error("Error when creating network macro", networkMacro, err)
 		return "", err
@@ -1454,7 +2051,7 @@ func (nvsdc *NuageVsdClient) CreateNetworkMacro(enterpriseID string, networkMacr
 		return result[0].ID, nil
 	case 409:
 		//Network Macro already exists, call Get to retrieve the ID
-		id, err := nvsdc.GetNetworkMacroID(enterpriseID, networkMacro)
+		id, err := nvsdc.GetNetworkMacroIDCtx(ctx, enterpriseID, networkMacro)
 		if err != nil {
 			glog.Errorf("Error when getting network macro ID: %v - %v", networkMacro, err)
 			return "", err
@@ -1466,12 +2063,21 @@ func (nvsdc *NuageVsdClient) CreateNetworkMacro(enterpriseID string, networkMacr
 }
 
 func (nvsdc *NuageVsdClient) GetNetworkMacroID(enterpriseID string, networkMacro *api.VsdNetworkMacro) (string, error) {
+	return nvsdc.GetNetworkMacroIDCtx(nvsdc.ctx, enterpriseID, networkMacro)
+}
+
+// GetNetworkMacroIDCtx is GetNetworkMacroID with an explicit context;
+// cancelling ctx aborts the in-flight HTTP request itself (see ctxTransport)
+// instead of just unblocking the caller while it keeps running.
+func (nvsdc *NuageVsdClient) GetNetworkMacroIDCtx(ctx context.Context, enterpriseID string, networkMacro *api.VsdNetworkMacro) (string, error) {
 	result := make([]api.VsdNetworkMacro, 1)
 	h := nvsdc.session.Header
 	h.Add("X-Nuage-Filter", `name == "`+networkMacro.Name+`" and IPType =="`+networkMacro.IPType+`" and address == "`+networkMacro.Address+
 		`" and netmask == "`+networkMacro.Netmask+`"`)
 	e := api.RESTError{}
-	resp, err := nvsdc.session.Get(nvsdc.url+"enterprises/"+enterpriseID+"/networkmacros", nil, &result, &e)
+	resp, err := nvsdc.ctxVsdRequest(ctx, "get_network_macro_id", "network_macro", func() (*napping.Response, error) {
+		return nvsdc.session.Get(nvsdc.url+"enterprises/"+enterpriseID+"/networkmacros", nil, &result, &e)
+	})
 	h.Del("X-Nuage-Filter")
 	if err != nil {
 		glog.Errorf("Error when getting network macro ID for network macro: %v - %v", networkMacro, err)
@@ -1496,11 +2102,20 @@ func (nvsdc *NuageVsdClient) GetNetworkMacroID(enterpriseID string, networkMacro
 }
 
 func (nvsdc *NuageVsdClient) DeleteNetworkMacro(networkMacroID string) error {
+	return nvsdc.DeleteNetworkMacroCtx(nvsdc.ctx, networkMacroID)
+}
+
+// DeleteNetworkMacroCtx is DeleteNetworkMacro with an explicit context;
+// cancelling ctx aborts the in-flight HTTP request itself (see ctxTransport)
+// instead of just unblocking the caller while it keeps running.
+func (nvsdc *NuageVsdClient) DeleteNetworkMacroCtx(ctx context.Context, networkMacroID string) error {
 	// Delete network macro
 	result := make([]struct{}, 1)
 	e := api.RESTError{}
 	url := nvsdc.url + "enterprisenetworks/" + networkMacroID + "?responseChoice=1"
-	resp, err := nvsdc.session.Delete(url, &result, &e)
+	resp, err := nvsdc.ctxVsdRequest(ctx, "delete_network_macro", "network_macro", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(url, &result, &e)
+	})
 	if err != nil {
 		glog.Errorf("Error when deleting network macro with ID %s: %s", networkMacroID, err)
 		return err
@@ -1514,10 +2129,98 @@ func (nvsdc *NuageVsdClient) DeleteNetworkMacro(networkMacroID string) error {
 	}
 }
 
+// VsdError is the structured form of a failed VSD REST call, carrying
+// everything VsdErrorResponse used to just log and throw away: the HTTP
+// status, VSD's own internal error code, its top-level message and the
+// per-property validation errors alongside it. Callers that need to
+// distinguish "already gone" from "genuinely failed" should use IsNotFound,
+// IsConflict and IsInUse instead of comparing HTTPStatus/InternalCode
+// directly.
+type VsdError struct {
+	HTTPStatus   int
+	InternalCode int
+	Message      string
+	Errors       []api.RESTErrorProperty
+}
+
+func (e *VsdError) Error() string {
+	return fmt.Sprintf("VSD request failed with status %d (internal code %d): %s", e.HTTPStatus, e.InternalCode, e.Message)
+}
+
+// IsNotFound reports whether err is a VsdError for an object VSD no longer
+// has. Callers tearing down a namespace or NetworkPolicy should treat this
+// the same as a successful delete instead of aborting the rest of the
+// teardown.
+func IsNotFound(err error) bool {
+	verr, ok := err.(*VsdError)
+	return ok && verr.HTTPStatus == 404
+}
+
+// IsConflict reports whether err is a VsdError for a 409 response - VSD
+// rejected a create because an object with the same identity already
+// exists.
+func IsConflict(err error) bool {
+	verr, ok := err.(*VsdError)
+	return ok && verr.HTTPStatus == 409
+}
+
+// IsInUse reports whether err is a VsdError for a delete VSD refused
+// because the object is still referenced - e.g. a zone or network macro
+// group with child objects still attached. Retrying immediately won't help
+// until whatever references it is cleaned up first; deleteWithReconcile
+// uses this to decide when that cleanup is worth attempting itself rather
+// than giving up and leaving the object for the next reconcile pass.
+func IsInUse(err error) bool {
+	verr, ok := err.(*VsdError)
+	return ok && verr.HTTPStatus == 409 && len(verr.Errors) > 0
+}
+
+const (
+	deleteReconcileAttempts = 3
+	deleteReconcileBackoff  = 500 * time.Millisecond
+)
+
+// deleteWithReconcile calls deleteFn, and if VSD refuses the delete because
+// the object is still in use, calls detachChildren - which should clear the
+// known child references this plugin itself created, e.g. removing a
+// network macro from the group it was added to, or re-deleting an ACL entry
+// that still points at a network macro group - and retries deleteFn with
+// exponential backoff. A prior create that returned but left the object
+// half-provisioned, or a child delete that raced with this one, both show up
+// as the same in-use error, so reconciling unconditionally on every in-use
+// response handles both without needing to tell them apart. It gives up and
+// returns the last error once deleteReconcileAttempts is reached, or
+// immediately for any error that isn't an in-use conflict. Modeled on the
+// reconcile-before-delete flow ARO's deleteNic uses for a VM NIC stuck with
+// attachments.
+func deleteWithReconcile(deleteFn func() error, detachChildren func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = deleteFn()
+		if err == nil || IsNotFound(err) {
+			return nil
+		}
+		if !IsInUse(err) || attempt >= deleteReconcileAttempts {
+			return err
+		}
+		glog.Warningf("VSD object still in use on delete (attempt %d/%d), detaching known child references and retrying: %s",
+			attempt+1, deleteReconcileAttempts, err)
+		if derr := detachChildren(); derr != nil {
+			glog.Warningf("Failed to detach child references before retrying delete: %s", derr)
+		}
+		time.Sleep(deleteReconcileBackoff * (1 << uint(attempt)))
+	}
+}
+
 func VsdErrorResponse(resp *napping.Response, e *api.RESTError) error {
 	glog.Errorln("Bad response status from VSD Server")
 	glog.Errorf("\t Raw Text:\n%v\n", resp.RawText())
 	glog.Errorf("\t Status:  %v\n", resp.Status())
 	glog.Errorf("\t Internal error code: %v\n", e.InternalErrorCode)
-	return errors.New("Unexpected error code: " + fmt.Sprintf("%v", resp.Status()))
+	return &VsdError{
+		HTTPStatus:   resp.Status(),
+		InternalCode: e.InternalErrorCode,
+		Message:      e.Message,
+		Errors:       e.Errors,
+	}
 }
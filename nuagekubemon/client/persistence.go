@@ -0,0 +1,239 @@
+/*
+###########################################################################
+#
+#   Filename:           persistence.go
+#
+#   Author:             Ryan Fredette
+#   Created:            October 5, 2015
+#
+#   Description:        Snapshot/restore support for IPv4SubnetPool
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+type poolJSON struct {
+	Free [33][]*IPv4Subnet `json:"free"`
+}
+
+func (pool *IPv4SubnetPool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(poolJSON{Free: *pool})
+}
+
+func (pool *IPv4SubnetPool) UnmarshalJSON(data []byte) error {
+	var snap poolJSON
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	*pool = snap.Free
+	return nil
+}
+
+// MarshalBinary produces a gob-encoded snapshot of the pool's free lists.
+// It's more compact than MarshalJSON and is what SaveTo/LoadFrom use.
+func (pool *IPv4SubnetPool) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode([33][]*IPv4Subnet(*pool)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (pool *IPv4SubnetPool) UnmarshalBinary(data []byte) error {
+	var lists [33][]*IPv4Subnet
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&lists); err != nil {
+		return err
+	}
+	*pool = lists
+	return nil
+}
+
+// SaveTo writes a binary snapshot of the pool to w.
+func (pool *IPv4SubnetPool) SaveTo(w io.Writer) error {
+	data, err := pool.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// LoadFrom replaces the pool's contents with a snapshot previously written
+// by SaveTo.
+func (pool *IPv4SubnetPool) LoadFrom(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return pool.UnmarshalBinary(data)
+}
+
+// Backend is where a PersistentPool's snapshots are written to and read
+// back from.  FileBackend and KVBackend are the two implementations we
+// need today (a local file for a single-node agent, and a KVClient-backed
+// store for etcd or a Kubernetes CRD); callers can supply their own for
+// anything else.
+type Backend interface {
+	Load() ([]byte, error)
+	Store(snapshot []byte) error
+}
+
+// FileBackend stores the snapshot as a single file on local disk, writing
+// through a temp file + rename so a crash mid-write can't leave a
+// truncated snapshot behind.
+type FileBackend struct {
+	Path string
+}
+
+func (b *FileBackend) Load() ([]byte, error) {
+	data, err := ioutil.ReadFile(b.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (b *FileBackend) Store(snapshot []byte) error {
+	tmpPath := b.Path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, snapshot, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, b.Path)
+}
+
+// KVClient is the minimal interface a remote key/value store needs to back
+// a KVBackend.  An etcd client or a Kubernetes CRD-backed client (storing
+// the snapshot in a status field, say) can both satisfy this without the
+// client package needing to depend on either library directly.
+type KVClient interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+}
+
+// KVBackend stores the snapshot under a single key in a KVClient.
+type KVBackend struct {
+	Client KVClient
+	Key    string
+}
+
+func (b *KVBackend) Load() ([]byte, error) {
+	return b.Client.Get(b.Key)
+}
+
+func (b *KVBackend) Store(snapshot []byte) error {
+	return b.Client.Put(b.Key, snapshot)
+}
+
+// persistentSnapshot embeds the pool's free lists directly, as a plain
+// [33][]*IPv4Subnet, rather than as an IPv4SubnetPool field: IPv4SubnetPool
+// only defines MarshalJSON/UnmarshalJSON on a pointer receiver, which
+// json.Marshal can't reach through a by-value struct field, so going
+// through IPv4SubnetPool here would silently fall back to its default
+// array encoding - which UnmarshalJSON can't then decode back.
+type persistentSnapshot struct {
+	Generation uint64            `json:"generation"`
+	Free       [33][]*IPv4Subnet `json:"free"`
+}
+
+/* PersistentPool wraps an IPv4SubnetPool with a Backend so that Alloc and
+ * Free write through a snapshot on every mutation.  The snapshot carries a
+ * monotonically increasing generation number; restoring from a snapshot
+ * with a lower generation than one already seen indicates a concurrent
+ * writer raced us, which callers can use to decide whether to re-Restore
+ * before trusting the in-memory pool.  Without this, restarting the Nuage
+ * CNI/monitor loses allocation state and risks double-assigning the same
+ * subnet to two nodes.
+ */
+type PersistentPool struct {
+	Pool    IPv4SubnetPool
+	Backend Backend
+
+	mu         sync.Mutex
+	generation uint64
+}
+
+func (p *PersistentPool) Generation() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.generation
+}
+
+func (p *PersistentPool) Alloc(size int) (*IPv4Subnet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subnet, err := p.Pool.Alloc(size)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.persist(); err != nil {
+		// Don't let the in-memory pool and the backend disagree about
+		// what's free; undo the allocation and surface the error.
+		p.Pool.Free(subnet)
+		return nil, err
+	}
+	return subnet, nil
+}
+
+func (p *PersistentPool) Free(subnet *IPv4Subnet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.Pool.Free(subnet); err != nil {
+		return err
+	}
+	return p.persist()
+}
+
+// persist must be called with p.mu held.
+func (p *PersistentPool) persist() error {
+	if p.Backend == nil {
+		return nil
+	}
+	nextGeneration := p.generation + 1
+	data, err := json.Marshal(persistentSnapshot{Generation: nextGeneration, Free: [33][]*IPv4Subnet(p.Pool)})
+	if err != nil {
+		return err
+	}
+	if err := p.Backend.Store(data); err != nil {
+		return err
+	}
+	p.generation = nextGeneration
+	return nil
+}
+
+// Restore loads the most recent snapshot from the backend, replacing the
+// in-memory pool and generation.  It's a no-op if the backend has never
+// been written to.
+func (p *PersistentPool) Restore() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Backend == nil {
+		return nil
+	}
+	data, err := p.Backend.Load()
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	var snap persistentSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	p.Pool = IPv4SubnetPool(snap.Free)
+	p.generation = snap.Generation
+	return nil
+}
@@ -0,0 +1,295 @@
+/*
+###########################################################################
+#
+#   Filename:           servicepolicy.go
+#
+#   Author:             Ryan Fredette
+#   Created:            November 9, 2015
+#
+#   Description:        Keeps Service ClusterIP traffic reaching pods that
+#                        a NetworkPolicy has been applied to
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/jmcvetta/napping"
+	"github.com/nuagenetworks/openshift-integration/nuagekubemon/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// serviceInfo is what HandleServiceEvent remembers about a Service between
+// events, so reconcileServiceAcls can later decide whether it backs the
+// pods some NetworkPolicy selects without re-reading the Service.
+type serviceInfo struct {
+	namespace string
+	selector  map[string]string
+	clusterIP string
+	nodePort  int32
+}
+
+// serviceAclPriorityFloor puts the "allow Service traffic in" entry
+// reconcileServiceAcls installs below every entry CreateNetworkPolicy
+// generates for the same policy (networkPolicyPriorityFloor and up), and
+// above the zone-to-services entries CreateSpecificZoneAcls installs, so
+// kube-proxy-DNAT'd Service traffic reaches the pods regardless of what the
+// policy's own ingress rules say.
+const serviceAclPriorityFloor = 90000
+
+func serviceKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func serviceMacroGroupName(namespace, policyName string) string {
+	return "NetworkPolicy-" + namespace + "-" + policyName + "-services"
+}
+
+// serviceBacksPods reports whether some pod cached for namespace satisfies
+// both podSelector (a NetworkPolicy's PodSelector) and a Service's own
+// selector, i.e. the Service is backed by at least one pod the policy
+// applies to.  An empty Service selector never matches, per Kubernetes
+// convention.
+func (nvsdc *NuageVsdClient) serviceBacksPods(namespace string, podSelector *metav1.LabelSelector, serviceSelector map[string]string) bool {
+	if len(serviceSelector) == 0 {
+		return false
+	}
+	sel, err := metav1.LabelSelectorAsSelector(podSelector)
+	if err != nil {
+		glog.Errorf("Invalid PodSelector in namespace %s: %s", namespace, err)
+		return false
+	}
+	svcSel := labels.SelectorFromSet(serviceSelector)
+	for _, podLabels := range nvsdc.namedPorts.PodLabels(namespace) {
+		set := labels.Set(podLabels)
+		if sel.Matches(set) && svcSel.Matches(set) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileServiceAcls rebuilds namespace/policyName's Service macro group
+// to contain exactly the ClusterIPs of Services currently backing the pods
+// podSelector targets, creating the macro group and its "allow Service
+// traffic" ingress ACL entries the first time it's called for state and
+// just updating macro group membership on every later call - a Service add
+// or delete, or a NetworkPolicy update via UpdateNetworkPolicy.
+//
+// NodePort Services would also need their nodes' IPs added to the macro
+// group, so kube-proxy's DNAT'd traffic isn't dropped, but that requires a
+// node informer this package doesn't have yet; for now such Services only
+// get their ClusterIP allowed, and a warning is logged so the gap stays
+// visible instead of silently under-allowing traffic.
+func (nvsdc *NuageVsdClient) reconcileServiceAcls(namespace, policyName string, podSelector *metav1.LabelSelector, state *networkPolicyState) error {
+	if state.serviceMacroGroupID == "" {
+		nmgID, err := nvsdc.CreateNetworkMacroGroup(nvsdc.enterpriseID, serviceMacroGroupName(namespace, policyName))
+		if err != nil {
+			glog.Errorf("Error when creating the Service macro group for NetworkPolicy %s/%s", namespace, policyName)
+			return err
+		}
+		state.serviceMacroGroupID = nmgID
+		state.serviceMacroIDs = make(map[string]string)
+	}
+	wanted := make(map[string]serviceInfo)
+	for key, svc := range nvsdc.services {
+		if svc.namespace == namespace && nvsdc.serviceBacksPods(namespace, podSelector, svc.selector) {
+			wanted[key] = svc
+		}
+	}
+	for key, svc := range wanted {
+		if _, exists := state.serviceMacroIDs[key]; exists {
+			continue
+		}
+		if svc.nodePort != 0 {
+			glog.Warningf("Service %s backs NetworkPolicy %s/%s's pods and has a NodePort; only its ClusterIP is allowed, not the node IPs NodePort traffic arrives from", key, namespace, policyName)
+		}
+		etherType, ipType := addressFamily(svc.clusterIP)
+		macro := &api.VsdNetworkMacro{
+			Name:    "NetworkPolicy service " + key,
+			IPType:  ipType,
+			Address: svc.clusterIP,
+			Netmask: fullNetmask(etherType),
+		}
+		macroID, err := nvsdc.CreateNetworkMacro(nvsdc.enterpriseID, macro)
+		if err != nil {
+			glog.Errorf("Error when creating the Service macro for %s", key)
+			return err
+		}
+		if err := nvsdc.addMacroToGroup(macroID, state.serviceMacroGroupID); err != nil {
+			return err
+		}
+		state.serviceMacroIDs[key] = macroID
+	}
+	for key, macroID := range state.serviceMacroIDs {
+		if _, stillWanted := wanted[key]; stillWanted {
+			continue
+		}
+		err := deleteWithReconcile(
+			func() error { return nvsdc.DeleteNetworkMacro(macroID) },
+			func() error { return nvsdc.removeMacroFromGroup(macroID, state.serviceMacroGroupID) },
+		)
+		if err != nil {
+			glog.Errorf("Error when deleting the stale Service macro for %s", key)
+			return err
+		}
+		delete(state.serviceMacroIDs, key)
+	}
+	if len(state.serviceAclIDs) == 0 {
+		for _, etherType := range nvsdc.etherTypes() {
+			aclEntry := api.VsdAclEntry{
+				Action:       "FORWARD",
+				Description:  "Allow Service Traffic To NetworkPolicy " + namespace + "/" + policyName + etherTypeSuffix(etherType),
+				EntityScope:  "ENTERPRISE",
+				EtherType:    etherType,
+				LocationType: "NETWORK_MACRO_GROUP",
+				LocationID:   state.serviceMacroGroupID,
+				NetworkType:  "POLICYGROUP",
+				NetworkID:    state.policyGroupID,
+				PolicyState:  "LIVE",
+				// Allocated monotonically, the same way reconcileRuleAclEntries
+				// allocates the policy's own rule entries, instead of a fixed
+				// per-policy floor every policy's entries would collide on.
+				Priority:  serviceAclPriorityFloor + nvsdc.NextAvailablePriority(),
+				Protocol:  "ANY",
+				Reflexive: false,
+			}
+			aclID, err := nvsdc.CreateAclEntry(nvsdc.ingressAclTemplateID, true, &aclEntry)
+			if err != nil {
+				glog.Errorf("Error when creating the Service traffic ACL entry for NetworkPolicy %s/%s", namespace, policyName)
+				return err
+			}
+			state.serviceAclIDs = append(state.serviceAclIDs, aclID)
+		}
+	}
+	return nil
+}
+
+// deleteServiceAcls undoes reconcileServiceAcls: it removes the ACL
+// entries, every per-Service macro, and the macro group itself.
+func (nvsdc *NuageVsdClient) deleteServiceAcls(state *networkPolicyState) error {
+	// deleteServiceTrafficAcls removes the "allow Service traffic" ingress
+	// ACL entries reconcileServiceAcls installed against the Service macro
+	// group; it's also what deleteWithReconcile below reruns if the group
+	// delete comes back in-use, since that means one of these entries is
+	// still pointing at it.
+	deleteServiceTrafficAcls := func() error {
+		for _, aclID := range state.serviceAclIDs {
+			if err := nvsdc.DeleteAclEntry(true, aclID); err != nil && !IsNotFound(err) {
+				glog.Errorf("Error when deleting Service traffic ACL entry %s for NetworkPolicy: %s", aclID, err)
+				return err
+			}
+		}
+		return nil
+	}
+	if err := deleteServiceTrafficAcls(); err != nil {
+		return err
+	}
+	for key, macroID := range state.serviceMacroIDs {
+		err := deleteWithReconcile(
+			func() error { return nvsdc.DeleteNetworkMacro(macroID) },
+			func() error { return nvsdc.removeMacroFromGroup(macroID, state.serviceMacroGroupID) },
+		)
+		if err != nil {
+			glog.Errorf("Error when deleting Service macro for %s: %s", key, err)
+			return err
+		}
+	}
+	if state.serviceMacroGroupID != "" {
+		err := deleteWithReconcile(
+			func() error { return nvsdc.DeleteNetworkMacroGroup(state.serviceMacroGroupID) },
+			deleteServiceTrafficAcls,
+		)
+		if err != nil {
+			glog.Errorf("Error when deleting Service macro group %s for NetworkPolicy: %s", state.serviceMacroGroupID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// addMacroToGroup adds an existing network macro to a network macro group,
+// the same way HandleServiceEvent adds a Service's own ClusterIP macro to
+// its namespace's default macro group.
+func (nvsdc *NuageVsdClient) addMacroToGroup(macroID, groupID string) error {
+	payload := []string{macroID}
+	e := api.RESTError{}
+	resp, err := instrumentVsdRequest("add_macro_to_group", "network_macro_group", func() (*napping.Response, error) {
+		return nvsdc.session.Put(nvsdc.url+"networkmacrogroups/"+groupID+"/enterprisenetworks", &payload, nil, &e)
+	})
+	if err != nil {
+		glog.Error("Error when adding network macro to the network macro group", err)
+		return err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when adding network macro to the network macro group")
+	switch resp.Status() {
+	case 204:
+		return nil
+	case 409:
+		return nil
+	default:
+		return VsdErrorResponse(resp, &e)
+	}
+}
+
+// removeMacroFromGroup undoes addMacroToGroup: it's the corrective step
+// deleteWithReconcile takes when deleting a network macro comes back in-use,
+// since that almost always means the macro is still a member of groupID.
+func (nvsdc *NuageVsdClient) removeMacroFromGroup(macroID, groupID string) error {
+	result := make([]struct{}, 1)
+	e := api.RESTError{}
+	url := nvsdc.url + "networkmacrogroups/" + groupID + "/enterprisenetworks/" + macroID
+	resp, err := instrumentVsdRequest("remove_macro_from_group", "network_macro_group", func() (*napping.Response, error) {
+		return nvsdc.session.Delete(url, &result, &e)
+	})
+	if err != nil {
+		glog.Error("Error when removing network macro from the network macro group", err)
+		return err
+	}
+	glog.Infoln("Got a reponse status", resp.Status(), "when removing network macro from the network macro group")
+	switch resp.Status() {
+	case 204:
+		return nil
+	case 404:
+		return nil
+	default:
+		return VsdErrorResponse(resp, &e)
+	}
+}
+
+// fullNetmask returns the all-ones netmask/prefix for etherType's address
+// family, for macros - like a Service's ClusterIP - that name a single host
+// rather than a CIDR block.
+func fullNetmask(etherType string) string {
+	if etherType == "0x86DD" {
+		return (&IPv6Subnet{CIDRMask: 128}).Netmask().String()
+	}
+	return IPv4Subnet{CIDRMask: 32}.Netmask().String()
+}
+
+// reconcileNamespaceServiceAcls re-runs reconcileServiceAcls for every
+// NetworkPolicy currently tracked in namespace, so a Service add or delete
+// updates Service macro group membership for policies that were already
+// created before the Service changed.
+func (nvsdc *NuageVsdClient) reconcileNamespaceServiceAcls(namespace string) {
+	prefix := namespace + "/"
+	for key, state := range nvsdc.networkPolicies {
+		policyName := strings.TrimPrefix(key, prefix)
+		if policyName == key {
+			continue
+		}
+		if err := nvsdc.reconcileServiceAcls(namespace, policyName, state.podSelector, state); err != nil {
+			glog.Errorf("Error reconciling Service ACLs for NetworkPolicy %s after a Service change: %s", key, err)
+		}
+	}
+}
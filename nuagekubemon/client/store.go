@@ -0,0 +1,161 @@
+/*
+###########################################################################
+#
+#   Filename:           store.go
+#
+#   Author:             Aniket Bhat
+#   Created:            July 25, 2026
+#
+#   Description:        Persists zone/network-macro/network-macro-group IDs
+#                        to a local JSON file so a restart can find and
+#                        clean up an object the in-memory maps never learned
+#                        about
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultVsdStorePath is where Init points vsdStore if NuageKubeMonConfig
+// doesn't set VsdStorePath.
+const defaultVsdStorePath = "/var/lib/nuage-k8s/vsd-store.json"
+
+// vsdResourceType is one of the VSD object kinds vsdStore tracks, so a zone
+// and a network macro group that happen to share a name (both are commonly
+// named after the same namespace) don't collide in the store.
+type vsdResourceType string
+
+const (
+	vsdResourceZone              vsdResourceType = "zone"
+	vsdResourceNetworkMacro      vsdResourceType = "network_macro"
+	vsdResourceNetworkMacroGroup vsdResourceType = "network_macro_group"
+)
+
+// vsdStoreKey identifies one VSD object vsdStore tracks.
+type vsdStoreKey struct {
+	EnterpriseID string
+	ResourceType vsdResourceType
+	Name         string
+}
+
+// vsdStoreRecord is what vsdStore persists for one vsdStoreKey: the VSD
+// object's own ID, the Kubernetes namespace that owns it (so ReconcileStore
+// can tell whether that namespace still exists after a restart), and
+// DbIndex, a write counter in the same spirit as the dbIndex/dbExists
+// fields libnetwork's Windows driver keeps on hnsEndpoint/
+// networkConfiguration to make cleanup idempotent across restarts.
+type vsdStoreRecord struct {
+	Key       vsdStoreKey
+	VsdID     string
+	Namespace string
+	DbIndex   uint64
+}
+
+// vsdStore is a JSON-file-backed map of vsdStoreKey to vsdStoreRecord,
+// written transactionally (temp file, then rename) around the Create/Delete
+// of every namespace zone, namespace network macro group and Service
+// network macro. The network macros and macro groups that NetworkPolicy
+// handling creates are not recorded here.
+// Without it, a crash between a VSD Create succeeding and its ID landing in
+// NuageVsdClient's in-memory namespaces/zones maps leaks that object
+// forever, since DeleteNetworkMacroGroup/DeleteNetworkMacro would need an
+// ID nothing remembers.
+type vsdStore struct {
+	mu      sync.Mutex
+	path    string
+	nextIdx uint64
+	records map[vsdStoreKey]vsdStoreRecord
+}
+
+// newVsdStore loads path if it exists, or starts empty - a store that's
+// never been written has nothing to reconcile.
+func newVsdStore(path string) (*vsdStore, error) {
+	store := &vsdStore{path: path, records: make(map[vsdStoreKey]vsdStoreRecord)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading VSD store %s: %s", path, err)
+	}
+	var records []vsdStoreRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parsing VSD store %s: %s", path, err)
+	}
+	for _, record := range records {
+		store.records[record.Key] = record
+		if record.DbIndex >= store.nextIdx {
+			store.nextIdx = record.DbIndex + 1
+		}
+	}
+	return store, nil
+}
+
+// put records that key now maps to vsdID, owned by namespace, and persists
+// the store to disk before returning so a crash right after a VSD Create
+// still leaves a record of it.
+func (store *vsdStore) put(key vsdStoreKey, vsdID, namespace string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.records[key] = vsdStoreRecord{Key: key, VsdID: vsdID, Namespace: namespace, DbIndex: store.nextIdx}
+	store.nextIdx++
+	return store.save()
+}
+
+// delete removes key and persists the store to disk before returning. It's
+// not an error for key to already be absent.
+func (store *vsdStore) delete(key vsdStoreKey) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.records, key)
+	return store.save()
+}
+
+// all returns every record currently in the store, for ReconcileStore to
+// check against the namespaces Kubernetes still has.
+func (store *vsdStore) all() []vsdStoreRecord {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	records := make([]vsdStoreRecord, 0, len(store.records))
+	for _, record := range store.records {
+		records = append(records, record)
+	}
+	return records
+}
+
+// save writes every record to a temp file next to store.path and renames it
+// into place, so a reader never observes a partially-written store.
+func (store *vsdStore) save() error {
+	records := make([]vsdStoreRecord, 0, len(store.records))
+	for _, record := range store.records {
+		records = append(records, record)
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(store.path), 0755); err != nil {
+		return fmt.Errorf("creating VSD store directory: %s", err)
+	}
+	tmp := store.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writing VSD store %s: %s", tmp, err)
+	}
+	if err := os.Rename(tmp, store.path); err != nil {
+		return fmt.Errorf("renaming VSD store %s into place: %s", tmp, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+###########################################################################
+#
+#   Filename:           subnet.go
+#
+#   Author:             Ryan Fredette
+#   Created:            September 14, 2015
+#
+#   Description:        Address-family-independent subnet abstractions
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Subnet is implemented by both IPv4Subnet and IPv6Subnet so that callers
+// which only need to format or compare a subnet (rather than do
+// family-specific arithmetic on it) can be written once for both address
+// families.
+type Subnet interface {
+	String() string
+	Mask() int
+}
+
+// IPSubnet is implemented by IPv4Subnet and IPv6Subnet so that CreateSubnet
+// and GetSubnetID can build and look up a single VSD subnet - v4-only,
+// v6-only, or dual-stack - from whichever IPSubnets the caller passes,
+// instead of duplicating each into a …V6 sibling.
+type IPSubnet interface {
+	Subnet
+	addressString() string
+	netmaskString() string
+	vsdIPType() string
+}
+
+// DualStackPool pairs an IPv4SubnetPool and an IPv6SubnetPool so that
+// Nuage subnet allocation for a namespace/zone can be requested as v4-only,
+// v6-only, or dual-stack, without callers needing to know which pools are
+// actually configured.
+type DualStackPool struct {
+	V4 *IPv4SubnetPool
+	V6 *IPv6SubnetPool
+}
+
+// AllocV4 allocates an IPv4 subnet of the given size (in CIDR mask bits).
+// It returns an error if this pool wasn't configured for IPv4.
+func (pool *DualStackPool) AllocV4(size int) (*IPv4Subnet, error) {
+	if pool.V4 == nil {
+		return nil, errors.New("DualStackPool has no IPv4 pool configured")
+	}
+	return pool.V4.Alloc(size)
+}
+
+// AllocV6 allocates an IPv6 subnet of the given size (in CIDR mask bits).
+// It returns an error if this pool wasn't configured for IPv6.
+func (pool *DualStackPool) AllocV6(size int) (*IPv6Subnet, error) {
+	if pool.V6 == nil {
+		return nil, errors.New("DualStackPool has no IPv6 pool configured")
+	}
+	return pool.V6.Alloc(size)
+}
+
+// FreeV4 returns subnet to the IPv4 pool.
+func (pool *DualStackPool) FreeV4(subnet *IPv4Subnet) error {
+	if pool.V4 == nil {
+		return errors.New("DualStackPool has no IPv4 pool configured")
+	}
+	return pool.V4.Free(subnet)
+}
+
+// FreeV6 returns subnet to the IPv6 pool.
+func (pool *DualStackPool) FreeV6(subnet *IPv6Subnet) error {
+	if pool.V6 == nil {
+		return errors.New("DualStackPool has no IPv6 pool configured")
+	}
+	return pool.V6.Free(subnet)
+}
+
+// parseSubnetPools splits a comma-separated config.NuageKubeMonConfig
+// SubnetPools value (e.g. "10.0.0.0/8,fd00::/48") into the IPv4 CIDR and the
+// IPv6 CIDR it contains, so Init can bring up an IPv4-only, IPv6-only, or
+// dual-stack pod network from one config field. ipv6 is nil if subnetPools
+// had no IPv6 entry.
+func parseSubnetPools(subnetPools string) (ipv4 *IPv4Subnet, ipv6 *IPv6Subnet, err error) {
+	for _, cidr := range strings.Split(subnetPools, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if strings.Contains(cidr, ":") {
+			if ipv6 != nil {
+				return nil, nil, fmt.Errorf("SubnetPools has more than one IPv6 CIDR: %q", subnetPools)
+			}
+			if ipv6, err = IPv6SubnetFromString(cidr); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			if ipv4 != nil {
+				return nil, nil, fmt.Errorf("SubnetPools has more than one IPv4 CIDR: %q", subnetPools)
+			}
+			if ipv4, err = IPv4SubnetFromString(cidr); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if ipv4 == nil && ipv6 == nil {
+		return nil, nil, fmt.Errorf("SubnetPools must contain at least one IPv4 or IPv6 CIDR: %q", subnetPools)
+	}
+	return ipv4, ipv6, nil
+}
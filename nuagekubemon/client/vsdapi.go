@@ -0,0 +1,142 @@
+/*
+###########################################################################
+#
+#   Filename:           vsdapi.go
+#
+#   Author:             Ryan Fredette
+#   Created:            November 16, 2015
+#
+#   Description:        VsdAPI interface, extracted from NuageVsdClient so
+#                        higher-level orchestration can be tested against a
+#                        mock instead of a live VSD
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"github.com/nuagenetworks/openshift-integration/nuagekubemon/api"
+	"github.com/nuagenetworks/openshift-integration/nuagekubemon/config"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// VsdAPI is everything Init, HandleNsEvent/HandleServiceEvent, and
+// CreateNetworkPolicy/DeleteNetworkPolicy need from a VSD client: enterprise
+// and domain bootstrap, zone/subnet/network-macro/ACL CRUD, and the
+// higher-level event handlers built on top of them.  NuageVsdClient is the
+// real, REST-backed implementation; MockVsdAPI (generated with mockgen from
+// this interface) lets that orchestration run against canned responses
+// instead of a live VSD.
+type VsdAPI interface {
+	Init(nkmConfig *config.NuageKubeMonConfig)
+
+	CreateEnterprise(enterpriseName string) (string, error)
+	CreateAdminUser(enterpriseID, user, password string) (string, error)
+	InstallLicense(licensePath string) error
+	LoginAsAdmin(user, password, enterpriseName string) error
+	CreateDomainTemplate(enterpriseID, domainTemplateName string) (string, error)
+	CreateDomain(enterpriseID, domainTemplateID, name string) (string, error)
+	DeleteDomain(id string) error
+
+	CreateIngressAclTemplate(domainID string) (string, error)
+	CreateEgressAclTemplate(domainID string) (string, error)
+	CreateAclEntry(templateID string, ingress bool, aclEntry *api.VsdAclEntry) (string, error)
+	GetAclEntry(templateID string, ingress bool, aclEntry *api.VsdAclEntry) (*api.VsdAclEntry, error)
+	DeleteAclEntry(ingress bool, aclID string) error
+
+	CreateZone(domainID, name string) (string, error)
+	DeleteZone(id string) error
+	GetZoneID(domainID, name string) (string, error)
+	ListZoneNames(domainID string) ([]string, error)
+
+	// CreateSubnet and GetSubnetID take one IPSubnet for a single-stack
+	// subnet, or one IPv4Subnet and one IPv6Subnet for a dual-stack subnet.
+	CreateSubnet(name, zoneID string, subnets ...IPSubnet) (string, error)
+	DeleteSubnet(id string) error
+	GetSubnetID(zoneID string, subnets ...IPSubnet) (string, error)
+
+	CreateNetworkMacro(enterpriseID string, networkMacro *api.VsdNetworkMacro) (string, error)
+	DeleteNetworkMacro(networkMacroID string) error
+	CreateNetworkMacroGroup(enterpriseID string, zoneName string) (string, error)
+	GetNetworkMacroGroupID(enterpriseID, nmgName string) (string, error)
+	DeleteNetworkMacroGroup(networkMacroGroupID string) error
+
+	CreatePolicyGroup(domainID, name string) (string, error)
+	DeletePolicyGroup(id string) error
+	CreateNetworkPolicy(policy *networkingv1.NetworkPolicy) error
+	UpdateNetworkPolicy(policy *networkingv1.NetworkPolicy) error
+	DeleteNetworkPolicy(namespace, name string) error
+
+	Run(nsChannel chan *api.NamespaceEvent, serviceChannel chan *api.ServiceEvent, stop chan bool)
+	HandleNsEvent(nsEvent *api.NamespaceEvent) error
+	HandleServiceEvent(serviceEvent *api.ServiceEvent) error
+	// ReconcileZones repairs drift between VSD's zones and currentNamespaces,
+	// the namespace names a Controller resync pass currently knows about.
+	ReconcileZones(currentNamespaces []string) error
+	// ReconcileStore deletes from VSD any zone/network-macro/
+	// network-macro-group the local store still remembers whose owning
+	// namespace isn't in currentNamespaces. Meant to run once, at startup.
+	ReconcileStore(currentNamespaces []string) error
+	// CheckZoneSubnetCapacity grows or shrinks each zone's subnets to track
+	// its current pod count.
+	CheckZoneSubnetCapacity()
+	// SetEventRecorder lets a Controller give this VsdAPI somewhere to post
+	// Namespace/Service Events when zone/subnet/network-macro creation
+	// fails.
+	SetEventRecorder(recorder record.EventRecorder)
+	// Shutdown cancels the context passed to this VsdAPI's in-flight VSD
+	// REST calls, so a Controller can unblock them when the reconcile loop
+	// that started them is torn down.
+	Shutdown()
+
+	// UpdatePodCache and RemovePodCache keep NamedPortCache current as the
+	// Controller's pod informer reports pods coming and going, so
+	// ResolveNamedPort has real container ports to resolve a NetworkPolicy's
+	// named ports against.
+	UpdatePodCache(namespace, podName string, labels map[string]string, containerPorts []corev1.ContainerPort)
+	RemovePodCache(namespace, podName string)
+}
+
+// bootstrapCluster creates the enterprise, admin user, license, domain and
+// ACL templates a fresh cluster needs, entirely through vsdAPI.  It's the
+// part of NuageVsdClient.Init that's pure orchestration - no session setup,
+// no subnet pools - so it can run against a MockVsdAPI in a test the same
+// way it runs against the real VSD in production.
+func bootstrapCluster(vsdAPI VsdAPI, nkmConfig *config.NuageKubeMonConfig) (enterpriseID, domainID string, err error) {
+	enterpriseID, err = vsdAPI.CreateEnterprise(clusterEnterpriseName)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err = vsdAPI.CreateAdminUser(enterpriseID, "admin", "admin"); err != nil {
+		return "", "", err
+	}
+	if err = vsdAPI.InstallLicense(nkmConfig.LicenseFile); err != nil {
+		return "", "", err
+	}
+	if err = vsdAPI.LoginAsAdmin("admin", "admin", clusterEnterpriseName); err != nil {
+		return "", "", err
+	}
+	domainTemplateID, err := vsdAPI.CreateDomainTemplate(enterpriseID, clusterDomainTemplateName)
+	if err != nil {
+		return "", "", err
+	}
+	domainID, err = vsdAPI.CreateDomain(enterpriseID, domainTemplateID, clusterDomainName)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err = vsdAPI.CreateIngressAclTemplate(domainID); err != nil {
+		return "", "", err
+	}
+	if _, err = vsdAPI.CreateEgressAclTemplate(domainID); err != nil {
+		return "", "", err
+	}
+	return enterpriseID, domainID, nil
+}
@@ -0,0 +1,59 @@
+/*
+###########################################################################
+#
+#   Filename:           vsdcontext.go
+#
+#   Author:             Aniket Bhat
+#   Created:            July 25, 2026
+#
+#   Description:        context.Context cancellation for VSD REST calls
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jmcvetta/napping"
+)
+
+// ctxTransport is session.Client's http.RoundTripper. Its base does the
+// actual round trip; ctx is whatever context.Context the in-flight
+// ctxVsdRequest call was given. napping has no context.Context parameter of
+// its own, so this is what lets a caller's ctx actually reach the
+// underlying net/http request and abort it - closing the connection - on
+// cancellation, instead of only unblocking the caller while the request
+// keeps running against VSD underneath.
+type ctxTransport struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+func (t *ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
+
+// ctxVsdRequest points nvsdc's session transport at ctx for the duration of
+// fn (via instrumentVsdRequest, so it's still counted and timed the same as
+// every other VSD call), so ctx actually bounds the underlying HTTP round
+// trip instead of merely being raced against it. Every caller of this
+// reaches it through a chain that holds nvsdc.mu for the whole call (see
+// NuageVsdClient.HandleNsEvent's doc comment), so swapping the shared
+// transport's ctx field here doesn't race a concurrent request.
+func (nvsdc *NuageVsdClient) ctxVsdRequest(ctx context.Context, operation, resource string, fn func() (*napping.Response, error)) (*napping.Response, error) {
+	nvsdc.transport.ctx = ctx
+	defer func() { nvsdc.transport.ctx = nil }()
+	return instrumentVsdRequest(operation, resource, fn)
+}
@@ -0,0 +1,135 @@
+/*
+###########################################################################
+#
+#   Filename:           vsdrequestpool.go
+#
+#   Author:             Aniket Bhat
+#   Created:            February 24, 2016
+#
+#   Description:        Bounded-concurrency, retrying, GET-coalescing layer
+#                        in front of NuageVsdClient's REST calls
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/jmcvetta/napping"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultVsdConcurrency = 4
+	defaultVsdMaxRetries  = 2
+	defaultVsdBackoff     = 500 * time.Millisecond
+)
+
+// vsdRequestPool bounds how many REST calls NuageVsdClient has in flight
+// against the VSD at once, retries idempotent ones with exponential backoff
+// on 5xx and transport errors, and folds concurrent identical GETs (e.g.
+// GetZoneID called for every NamespaceEvent in a startup replay) into a
+// single in-flight request via singleflight.  Without this, a burst of
+// namespace/service events serializes 3-6 blocking REST calls each with no
+// retry, and a transient VSD error or timeout hangs the whole reconcile.
+type vsdRequestPool struct {
+	sem        chan struct{}
+	group      singleflight.Group
+	maxRetries int
+	backoff    time.Duration
+}
+
+// newVsdRequestPool builds a vsdRequestPool from the VsdConcurrency/
+// VsdMaxRetries/VsdBackoff config knobs, falling back to sane defaults for
+// values that weren't set.
+func newVsdRequestPool(concurrency, maxRetries int, backoff time.Duration) *vsdRequestPool {
+	if concurrency <= 0 {
+		concurrency = defaultVsdConcurrency
+	}
+	if maxRetries <= 0 {
+		maxRetries = defaultVsdMaxRetries
+	}
+	if backoff <= 0 {
+		backoff = defaultVsdBackoff
+	}
+	return &vsdRequestPool{
+		sem:        make(chan struct{}, concurrency),
+		maxRetries: maxRetries,
+		backoff:    backoff,
+	}
+}
+
+// do runs fn under the pool's concurrency limit, retrying it with
+// exponential backoff when its result looks transient: a non-nil error (a
+// dropped connection or timeout from the transport, since napping only
+// returns err for those, not for VSD error status codes) or a 5xx response.
+// fn must be idempotent - every caller here is either a GET, or a POST whose
+// 409 case already falls back to an equivalent GET, so a retry that lands
+// after an earlier attempt actually succeeded just takes that Get fallback
+// path instead of creating a duplicate object.
+func (p *vsdRequestPool) do(fn func() (*napping.Response, error)) (*napping.Response, error) {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+
+	var resp *napping.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = fn()
+		if !retryableVsdResult(resp, err) || attempt >= p.maxRetries {
+			return resp, err
+		}
+		sleep := p.backoff * (1 << uint(attempt))
+		reason := "5xx response"
+		if isConnResetErr(err) {
+			reason = "connection dropped"
+		} else if err != nil {
+			reason = "transport error"
+		}
+		glog.Warningf("Transient error on VSD request (%s, attempt %d/%d), retrying in %s: %v",
+			reason, attempt+1, p.maxRetries+1, sleep, err)
+		time.Sleep(sleep)
+	}
+}
+
+// coalesce folds concurrent calls sharing the same key into a single
+// execution of fn: only the first caller for a key actually runs it, and
+// every caller - the one that ran fn and everyone who arrived while it was
+// in flight - gets its returned value and error.  fn does its own decoding
+// (typically via do, for the concurrency limit and retries), since a
+// napping response's body is decoded into a caller-supplied pointer as part
+// of the call rather than being available to copy out afterwards - the
+// value fn returns is what actually gets shared.
+func (p *vsdRequestPool) coalesce(key string, fn func() (interface{}, error)) (interface{}, error) {
+	v, err, _ := p.group.Do(key, fn)
+	return v, err
+}
+
+func retryableVsdResult(resp *napping.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp != nil && resp.Status() >= 500
+}
+
+// isConnResetErr reports whether err looks like a dropped connection rather
+// than something retrying would just repeat forever; kept separate from
+// retryableVsdResult's err != nil check so callers that want to log a
+// sharper message can tell the two apart.
+func isConnResetErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "EOF")
+}
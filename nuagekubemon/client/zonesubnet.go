@@ -0,0 +1,186 @@
+/*
+###########################################################################
+#
+#   Filename:           zonesubnet.go
+#
+#   Author:             Aniket Bhat
+#   Created:            July 25, 2026
+#
+#   Description:        Grows and shrinks a zone's subnets as its pod count
+#                        changes, instead of the single "<ns>-0" subnet
+#                        HandleNsEvent allocates a namespace's zone at
+#                        creation
+#
+###########################################################################
+#
+#              Copyright (c) 2015 Nuage Networks
+#
+###########################################################################
+
+*/
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// zoneSubnetSpareSubnets is how many whole spare subnets CheckZoneSubnetCapacity
+// tries to keep ahead of a zone's current pod count: less than one spare
+// subnet's worth of capacity left and it grows the zone another subnet, more
+// than double that and it shrinks one back, so a burst of pod creation
+// doesn't hit a bare NoAddressesAvailable failure and a scaled-down
+// namespace doesn't keep VSD subnets it no longer needs.  Scaling the
+// hysteresis by the zone's own subnet size (rather than a fixed address
+// count) keeps it meaningful for both a /24 (254 hosts) and a tiny subnet
+// size used in tests, instead of growing and immediately shrinking again on
+// every reconcileDrift pass.
+const zoneSubnetSpareSubnets = 1
+
+// zoneSubnetCapacity sums the host capacity of every subnet linked under
+// head, so CheckZoneSubnetCapacity can compare it against a zone's pod
+// count without caring how many subnets that capacity is split across.
+func zoneSubnetCapacity(head *SubnetList) uint64 {
+	var total uint64
+	for s := head; s != nil; s = s.Next {
+		total += s.Subnet.HostCount()
+	}
+	return total
+}
+
+// growZoneSubnet allocates one more subnet for zoneID and links it onto the
+// tail of nvsdc.subnets[zoneID], named "<namespace>-N" the same way
+// HandleNsEvent names the zone's first subnet "<namespace>-0".  Called when
+// CheckZoneSubnetCapacity finds a zone's pod count closing in on its
+// existing subnets' combined capacity.
+func (nvsdc *NuageVsdClient) growZoneSubnet(zoneID, namespace string) error {
+	head, exists := nvsdc.subnets[zoneID]
+	if !exists {
+		return fmt.Errorf("no subnets tracked for zone %s", zoneID)
+	}
+	tail, n := head, 1
+	for tail.Next != nil {
+		tail = tail.Next
+		n++
+	}
+	name := fmt.Sprintf("%s-%d", namespace, n)
+	var ipSubnets []IPSubnet
+	var subnet *IPv4Subnet
+	var err error
+	if nvsdc.ipv4Enabled {
+		subnet, err = nvsdc.pool.Alloc(32 - nvsdc.subnetSize)
+		if err != nil {
+			vsdPoolExhaustion.WithLabelValues("ipv4").Inc()
+			return err
+		}
+		ipSubnets = append(ipSubnets, subnet)
+	}
+	var subnetV6 *IPv6Subnet
+	if nvsdc.ipv6Enabled {
+		subnetV6, err = nvsdc.poolV6.Alloc(128 - nvsdc.subnetSizeV6)
+		if err != nil {
+			vsdPoolExhaustion.WithLabelValues("ipv6").Inc()
+			if subnet != nil {
+				nvsdc.pool.Free(subnet)
+			}
+			return err
+		}
+		ipSubnets = append(ipSubnets, subnetV6)
+	}
+	subnetID, err := nvsdc.CreateSubnet(name, zoneID, ipSubnets...)
+	if err != nil {
+		if subnet != nil {
+			nvsdc.pool.Free(subnet)
+		}
+		if subnetV6 != nil {
+			nvsdc.poolV6.Free(subnetV6)
+		}
+		return err
+	}
+	tail.Next = &SubnetList{SubnetID: subnetID, Subnet: subnet, SubnetV6: subnetV6}
+	glog.Infof("Grew zone %s with subnet %s, now %d subnets", zoneID, name, n+1)
+	return nil
+}
+
+// shrinkZoneSubnet deletes and frees the subnet at the tail of
+// nvsdc.subnets[zoneID], leaving the zone's first ("-0") subnet in place
+// even if it's the only one left, since HandleNsEvent and growZoneSubnet
+// both assume a zone always has at least one subnet.  It's a no-op for a
+// zone that's already down to just that one.
+func (nvsdc *NuageVsdClient) shrinkZoneSubnet(zoneID string) error {
+	head, exists := nvsdc.subnets[zoneID]
+	if !exists || head.Next == nil {
+		return nil
+	}
+	prev := head
+	for prev.Next.Next != nil {
+		prev = prev.Next
+	}
+	tail := prev.Next
+	if err := nvsdc.DeleteSubnet(tail.SubnetID); err != nil {
+		return err
+	}
+	if tail.Subnet != nil {
+		if err := nvsdc.pool.Free(tail.Subnet); err != nil {
+			glog.Warningf("Failed to free subnet %s back into the pool", tail.Subnet.String())
+		}
+	}
+	if tail.SubnetV6 != nil {
+		if err := nvsdc.poolV6.Free(tail.SubnetV6); err != nil {
+			glog.Warningf("Failed to free IPv6 subnet %s back into the pool", tail.SubnetV6.String())
+		}
+	}
+	prev.Next = nil
+	return nil
+}
+
+// CheckZoneSubnetCapacity compares every known namespace's current pod
+// count against its zone's subnets' combined host capacity, growing zones
+// that are running low and shrinking zones that have far more capacity
+// than their pod count needs.  It's meant to run periodically alongside
+// ReconcileZones - there's no per-subnet occupancy VSD exposes, so pod
+// count from the pod informer is the closest proxy available for
+// utilization without waiting for an actual allocation failure.
+// CheckZoneSubnetCapacity takes nvsdc.mu for the duration of the call; see
+// NuageVsdClient.HandleNsEvent's doc comment for why.
+func (nvsdc *NuageVsdClient) CheckZoneSubnetCapacity() {
+	nvsdc.mu.Lock()
+	defer nvsdc.mu.Unlock()
+	for namespace, nsData := range nvsdc.namespaces {
+		head := nvsdc.subnets[nsData.ZoneID]
+		if head == nil {
+			continue
+		}
+		podCount := uint64(len(nvsdc.namedPorts.PodLabels(namespace)))
+		capacity := zoneSubnetCapacity(head)
+		// HandleNsEvent and growZoneSubnet both allocate every subnet in a
+		// zone at the same subnetSize/subnetSizeV6, so whichever family is
+		// enabled gives the host count a single additional subnet would add;
+		// head.Subnet is nil on an IPv6-only cluster.
+		var subnetCapacity uint64
+		if head.Subnet != nil {
+			subnetCapacity = head.Subnet.HostCount()
+		} else if head.SubnetV6 != nil {
+			subnetCapacity = head.SubnetV6.HostCount()
+		}
+		spareThreshold := zoneSubnetSpareSubnets * subnetCapacity
+		switch {
+		// Strict: grow only once free capacity (capacity-podCount) actually
+		// drops under one spare subnet's worth, not merely down to it - a
+		// brand-new zone (podCount 0, capacity == one spareThreshold) must
+		// not immediately grow, or the shrink test below could never bring
+		// it back down to a single subnet (2*spareThreshold > 2*spareThreshold
+		// is never true).
+		case podCount+spareThreshold > capacity:
+			if err := nvsdc.growZoneSubnet(nsData.ZoneID, namespace); err != nil {
+				glog.Errorf("Error growing subnet for zone %s (namespace %s): %s", nsData.ZoneID, namespace, err)
+			}
+		case capacity-podCount > 2*spareThreshold:
+			if err := nvsdc.shrinkZoneSubnet(nsData.ZoneID); err != nil {
+				glog.Errorf("Error shrinking subnet for zone %s (namespace %s): %s", nsData.ZoneID, namespace, err)
+			}
+		}
+	}
+}